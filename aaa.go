@@ -6,32 +6,169 @@
 package aaa
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/danos/utils/guard"
 	"github.com/danos/utils/pathutil"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"plugin"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const AAAPluginsCfgDir = "/etc/aaa-plugins/"
 const AAAPluginsDir = "/usr/lib/aaa-plugins/"
 
+// Environment variables overriding AAAPluginsCfgDir and AAAPluginsDir
+// respectively, e.g. to load plugins from a test tree. Directories passed
+// explicitly to LoadAAAFrom take precedence over both.
+const (
+	EnvAAAPluginsCfgDir = "AAA_PLUGINS_CFG_DIR"
+	EnvAAAPluginsDir    = "AAA_PLUGINS_DIR"
+)
+
+// If set, the default plugin config and plugin directories are resolved
+// relative to the directory containing the running executable, by joining
+// ExecutableRelPluginsCfgDir and ExecutableRelPluginsDir respectively, rather
+// than AAAPluginsCfgDir and AAAPluginsDir. This allows relocatable installs,
+// e.g. under /opt/app. The absolute directories are used if the executable
+// can not be located. EnvAAAPluginsCfgDir and EnvAAAPluginsDir take precedence.
+var RelativeToExecutable bool
+
+// Locations of the plugin config and plugin directories relative to the
+// directory containing the executable, see RelativeToExecutable
+var (
+	ExecutableRelPluginsCfgDir = "../etc/aaa-plugins"
+	ExecutableRelPluginsDir    = "../lib/aaa-plugins"
+)
+
+// Returns the directory containing the running executable, with symlinks
+// resolved
+func executableDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	return filepath.Dir(exe), nil
+}
+
+// Returns the plugin config and plugin directories used by default, honouring
+// RelativeToExecutable, EnvAAAPluginsCfgDir and EnvAAAPluginsDir.
+func defaultAAADirs() (string, string) {
+	cfgDir, pluginDir := AAAPluginsCfgDir, AAAPluginsDir
+	if RelativeToExecutable {
+		if dir, err := executableDir(); err == nil {
+			cfgDir = filepath.Join(dir, ExecutableRelPluginsCfgDir)
+			pluginDir = filepath.Join(dir, ExecutableRelPluginsDir)
+		}
+	}
+	if dir := os.Getenv(EnvAAAPluginsCfgDir); dir != "" {
+		cfgDir = dir
+	}
+	if dir := os.Getenv(EnvAAAPluginsDir); dir != "" {
+		pluginDir = dir
+	}
+	return cfgDir, pluginDir
+}
+
 const (
 	aaaPluginAPIVersionSym = "AAAPluginAPIVersion"
 	aaaPluginImplSymFmt    = "AAAPluginV%d"
 
-	AAAPluginAPIVersion = 2
+	AAAPluginAPIVersion = 3
 )
 
+// Returned by AAAPlugin.Authenticate if the plugin does not support
+// authentication
+var ErrAuthNotSupported = errors.New("Authentication not supported")
+
+// Time allowed for a plugin's Setup to complete before the plugin is skipped.
+// Zero means no limit.
+var SetupTimeout = 10 * time.Second
+
+// If set, the LoadAAA functions fail as soon as any plugin fails to load or
+// set up, returning a nil AAA, rather than continuing with the remaining
+// plugins. Protocols already set up are torn down. Reloads are unaffected.
+var StrictLoad bool
+
+// If set, Reload only applies a reload if every plugin config loads and sets up
+// successfully, see Reload for what is rolled back otherwise.
+var StrictReload bool
+
+// Priority of a protocol whose config does not specify one
+const DefaultPriority = math.MaxInt32
+
 type AAAPluginConfig struct {
 	CmdAcct   bool   `json:"command-accounting"`
 	CmdAuthor bool   `json:"command-authorization"`
 	Name      string `json:"name"`
+	// Protocols are consulted in ascending order of priority
+	Priority int `json:"priority"`
+	// Expected hex encoded SHA-256 checksum of the plugin file, if any
+	Sha256 string `json:"sha256"`
+	// Time for which ValidUser results are cached; zero disables caching
+	ValidUserCacheSeconds int `json:"valid-user-cache-seconds"`
+	// Time for which negative ValidUser results are cached, if shorter than
+	// ValidUserCacheSeconds. Defaults to DefaultValidUserNegativeCacheSeconds.
+	ValidUserNegativeCacheSeconds int `json:"valid-user-negative-cache-seconds"`
+	// Contexts (e.g. "conf-mode") in which the protocol is used for command
+	// accounting and authorization; empty means all contexts
+	Contexts []string `json:"contexts"`
+	// Whether the plugin is loaded; defaults to true
+	Enabled *bool `json:"enabled"`
+	// Plugin specific settings, passed to the plugin if it implements
+	// AAAPluginConfigurer
+	Settings json.RawMessage `json:"settings"`
+	// Number of times accounting operations failing with a RetryableError
+	// are retried by tasks created with NewRetryingTask
+	AcctRetries int `json:"accounting-retries"`
+	// Delay before the first retry, doubling for each subsequent retry.
+	// Defaults to DefaultAcctRetryDelayMs.
+	AcctRetryDelayMs int `json:"accounting-retry-delay-ms"`
+	// Deadlines applied by AuthorizeCtx and NewTaskCtx respectively, in
+	// place of RequestTimeout; zero selects RequestTimeout. The accounting
+	// deadline also bounds each accounting call on tasks from NewTaskCtx.
+	AuthorizeTimeoutMs int `json:"authorize-timeout-ms"`
+	AcctTimeoutMs      int `json:"accounting-timeout-ms"`
+	// Symbol exporting the plugin implementation, in place of AAAPluginV3
+	// etc., so that one plugin file can export several plugins. The
+	// symbol must implement the interface of the API version the file
+	// exports. The plugins sharing a file name it with File.
+	Symbol string `json:"symbol"`
+	// Name of the plugin file in the plugin directory, in place of the
+	// plugin's name; PluginFileExt is appended as for the name
+	File string `json:"file"`
+}
+
+// IsEnabled reports whether the config enables its plugin
+func (c AAAPluginConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
 }
 
+// Well-known keys of the env map passed to plugins. Callers should populate
+// all those which are available.
+const (
+	EnvTTY        = "tty"         // TTY name, e.g. ttyS0
+	EnvRemoteAddr = "remote_addr" // Address of the remote client, e.g. of an SSH session
+	EnvRemotePort = "remote_port" // Port of the remote client
+	EnvSessionID  = "session_id"  // Identifier of the user's session
+	EnvRequestID  = "request_id"  // Correlation ID of the request, see WithRequestID
+	EnvTaskID     = "task_id"     // Unique identifier of the task, see TaskID
+)
+
 type AAATask interface {
 	// Account the start of the task
 	AccountStart() error
@@ -61,7 +198,12 @@ type AAAPlugin interface {
 	// - path: fully resolved (no abbreviations) path
 	// - pathAttrs: metadata of the path
 	// - env: map of available environment attributes. Supported mappings are:
-	//		tty : a TTY name eg. ttyS0
+	//		tty : a TTY name eg. ttyS0 (EnvTTY)
+	//		remote_addr : address of the remote client (EnvRemoteAddr)
+	//		remote_port : port of the remote client (EnvRemotePort)
+	//		session_id : identifier of the user's session (EnvSessionID)
+	//		request_id : correlation ID of the request (EnvRequestID)
+	//		task_id : unique identifier of the task (EnvTaskID)
 	NewTask(context string, uid uint32, groups []string, path []string,
 		pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error)
 
@@ -87,111 +229,1180 @@ type AAAPlugin interface {
 	// next authorization protocol if configured and supported.
 	Authorize(context string, uid uint32, groups []string, path []string,
 		pathAttrs *pathutil.PathAttrs) (bool, error)
+
+	// Authenticate a user the AAA protocol specific way.
+	// Parameters:
+	// - context: see Authorize
+	// - user: name of the user to authenticate
+	// - credentials: map of credentials provided by the user, e.g. "password"
+	//
+	// Should only return error if the authentication request could not be
+	// performed. Plugins which do not support authentication should return
+	// ErrAuthNotSupported.
+	Authenticate(context string, user string, credentials map[string]string) (bool, error)
+}
+
+// AAAPluginConfigurer may optionally be implemented by an AAAPlugin which
+// accepts settings from its config file (see AAAPluginConfig.Settings).
+type AAAPluginConfigurer interface {
+	// Called before Setup with the raw JSON settings from the plugin's
+	// config, which may be empty. The plugin decodes them according to its
+	// own schema. Returning an error causes the plugin to be skipped.
+	Configure(settings json.RawMessage) error
+}
+
+// AAAPluginTeardown may optionally be implemented by an AAAPlugin which needs
+// to release resources (sockets, goroutines, pending records, ...) when it is
+// unloaded.
+type AAAPluginTeardown interface {
+	// Called when the protocol is being removed or replaced, e.g. on reload.
+	// Must be idempotent, as it may be called more than once for the same
+	// plugin instance.
+	Teardown() error
 }
 
 type AAAProtocol struct {
 	Cfg    AAAPluginConfig
 	Plugin AAAPlugin
+	// Plugin API version implemented by the plugin, which may be older than
+	// AAAPluginAPIVersion. See Version.
+	APIVersion uint32
+	// Modification times of the config file and plugin file, as of when the
+	// protocol was loaded. Zero if not loaded from files.
+	ConfigModTime time.Time
+	PluginModTime time.Time
+
+	// Config file (relative to the config directory) the protocol was loaded from
+	cfgFile string
+	// Plugin opened, and the sha256 hash of its binary. Protocols re-opened
+	// from an unchanged binary share the same plugin, see openPluginFile and
+	// LookupSymbol, and the same plugin instance if they use the same
+	// symbol, see pluginInstance.
+	handle    *plugin.Plugin
+	pluginSum string
+
+	// Cached ValidUser results
+	userCacheMu sync.Mutex
+	userCache   map[string]validUserCacheEntry
+
+	// Result of the last health check, and of the ping once set up, if
+	// pinged (see PingOnSetup)
+	healthMu  sync.Mutex
+	healthErr error
+	pinged    bool
+	pingErr   error
+
+	// See Capabilities
+	capsOnce sync.Once
+	caps     Capabilities
+
+	// See Stats
+	statsMu sync.Mutex
+	stats   ProtocolStats
+
+	// Logger tracing plugin calls, see AAA.SetDebug
+	trace atomic.Value
 }
 
 type AAA struct {
+	// Deprecated: Protocols may be replaced by Reload; use Protocol and
+	// ForEachProtocol instead, which are safe for concurrent use.
 	Protocols map[string]*AAAProtocol
+
+	// Protects Protocols and the fields marked below
+	mu sync.RWMutex
+	// Serializes reloads
+	reloadMu sync.Mutex
+
+	// Where the protocols were loaded from
+	cfgFS     fs.FS
+	pluginDir string
+
+	logger Logger
+
+	// Only load plugins with command accounting enabled
+	acctOnly bool
+
+	// Tasks in flight, see Drain
+	tasks taskTracker
+	// Records queued by AccountAsync
+	async asyncAcct
+
+	// Protected by mu
+	metrics      MetricsSink
+	disabled     map[string]AAAPluginConfig // Configs of disabled plugins, by name
+	authzCache   *authzCache
+	authzAudit   *authzCache  // See SetAuthzAudit
+	authzLimiter *rateLimiter // See SetAuthzRateLimit
+	authzPolicy  AuthzPolicy
+	listeners    []func(ChangeEvent) // See OnChange
+	failed       []ChangeEvent       // Failures of the last load or Reload
+	debug        bool                // See SetDebug
+}
+
+// Logger is used to report problems encountered by the package, such as
+// plugins which fail to load.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Logs via the standard logger of the log package
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// VersionMismatchError is returned when a plugin implements a different
+// plugin API version than the one required by the loader.
+type VersionMismatchError struct {
+	Name string
+	Got  uint32
+	Want uint32
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("Unsupported %s for plugin %s: %d, expected %d",
+		aaaPluginAPIVersionSym, e.Name, e.Got, e.Want)
+}
+
+// DuplicatePluginError is returned when a plugin config declares the same
+// plugin name as a config file which sorts before it, or as a protocol which
+// was not loaded from a config file (see AddProtocol). The earlier config, or
+// the other protocol, is used.
+type DuplicatePluginError struct {
+	Name string
+	// Empty if the name is taken by a protocol not loaded from a config file
+	FirstFile string
+}
+
+func (e *DuplicatePluginError) Error() string {
+	if e.FirstFile == "" {
+		return fmt.Sprintf("Plugin %s is already added as an in-process protocol", e.Name)
+	}
+	return fmt.Sprintf("Plugin %s is already configured in %s", e.Name, e.FirstFile)
+}
+
+// Records the config file which first declared each plugin name
+type pluginNames map[string]string
+
+// Returns the names claimed by the protocols which were not loaded from a
+// config file, so that configs can not replace them
+func inProcessPluginNames(protocols map[string]*AAAProtocol) pluginNames {
+	names := make(pluginNames)
+	for name, protocol := range protocols {
+		if protocol.cfgFile == "" {
+			names[name] = ""
+		}
+	}
+	return names
+}
+
+func (n pluginNames) claim(name, file string) error {
+	if first, ok := n[name]; ok {
+		return &DuplicatePluginError{Name: name, FirstFile: first}
+	}
+	n[name] = file
+	return nil
+}
+
+// Plugin API versions supported by the loader, in descending order, each with
+// a function adapting that version's implementation symbol to AAAPlugin.
+var aaaPluginAPIVersions = []struct {
+	version uint32
+	adapt   func(sym plugin.Symbol) (AAAPlugin, bool)
+}{
+	{AAAPluginAPIVersion, func(sym plugin.Symbol) (AAAPlugin, bool) {
+		p, ok := sym.(AAAPlugin)
+		return p, ok
+	}},
+	{2, adaptAAAPluginV2},
+	{1, adaptAAAPluginV1},
+}
+
+// LoadErrors collects the errors encountered while loading individual
+// plugins. It is returned by LoadAAA and Reload alongside the usable set of
+// protocols which did load successfully.
+type LoadErrors []error
+
+func (e LoadErrors) Error() string {
+	return fmt.Sprintf("Failed to load %d AAA plugin(s): %s",
+		len(e), errorList(e).Error())
+}
+
+// Unwrap gives errors.Is and errors.As access to the individual errors from
+// Go 1.20. Is and As do so for earlier toolchains.
+func (e LoadErrors) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the errors matches target, see errors.Is
+func (e LoadErrors) Is(target error) bool {
+	return errorList(e).Is(target)
+}
+
+// As finds the first of the errors which matches target, see errors.As
+func (e LoadErrors) As(target interface{}) bool {
+	return errorList(e).As(target)
+}
+
+// A list of errors reported as one
+type errorList []error
+
+func (e errorList) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e errorList) Unwrap() []error {
+	return e
+}
+
+func (e errorList) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e errorList) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
 
-func lookupPluginImpl(name string, p *plugin.Plugin, ver uint32) (AAAPlugin, error) {
+// Returns the plugin implementation symbols of the supported API versions
+// which p exports, for diagnosing plugins exporting the wrong symbol
+func exportedImplSyms(p *plugin.Plugin) []string {
+	var syms []string
+	for _, v := range aaaPluginAPIVersions {
+		sym := fmt.Sprintf(aaaPluginImplSymFmt, v.version)
+		if _, err := p.Lookup(sym); err == nil {
+			syms = append(syms, sym)
+		}
+	}
+	return syms
+}
+
+// Returns the plugin implementation along with the API version it implements.
+// The implementation is looked up by the symbol named in cfg, if any, or else
+// by the symbol for the plugin's API version.
+func lookupPluginImpl(cfg AAAPluginConfig, p *plugin.Plugin) (AAAPlugin, uint32, error) {
 	symPluginVersion, err := p.Lookup(aaaPluginAPIVersionSym)
+	if err != nil {
+		err := fmt.Errorf("Plugin does not export the %s symbol", aaaPluginAPIVersionSym)
+		return nil, 0, err
+	}
 	version, ok := symPluginVersion.(*uint32)
 	if !ok {
-		err := fmt.Errorf("Unexpected type from " + aaaPluginAPIVersionSym + " symbol")
-		return nil, err
+		err := fmt.Errorf("Unexpected type %T from %s symbol, expected *uint32",
+			symPluginVersion, aaaPluginAPIVersionSym)
+		return nil, 0, err
 	}
-	if *version != ver {
-		err := fmt.Errorf("Unsupported %s for plugin %s: %d, expected %d",
-			aaaPluginAPIVersionSym, name, *version, ver)
-		return nil, err
+
+	const hint = "the plugin may have been built against a different plugin API version"
+	for _, v := range aaaPluginAPIVersions {
+		if *version != v.version {
+			continue
+		}
+
+		sym := fmt.Sprintf(aaaPluginImplSymFmt, v.version)
+		if cfg.Symbol != "" {
+			sym = cfg.Symbol
+		}
+		symPlugin, err := p.Lookup(sym)
+		if err != nil && cfg.Symbol != "" {
+			err := fmt.Errorf("Plugin does not export the %s symbol named in its config", sym)
+			return nil, 0, err
+		}
+		if err != nil {
+			found := "none"
+			if syms := exportedImplSyms(p); len(syms) > 0 {
+				found = strings.Join(syms, ", ")
+			}
+			err := fmt.Errorf("Plugin implements %s %d but does not export the %s symbol "+
+				"(exports: %s); %s", aaaPluginAPIVersionSym, v.version, sym, found, hint)
+			return nil, 0, err
+		}
+		aaaPlugin, ok := v.adapt(symPlugin)
+		if !ok {
+			err := fmt.Errorf("Unexpected type %T from %s symbol, which does not "+
+				"implement the version %d plugin interface; %s",
+				symPlugin, sym, v.version, hint)
+			return nil, 0, err
+		}
+		return aaaPlugin, v.version, nil
 	}
 
-	symPlugin, err := p.Lookup(fmt.Sprintf(aaaPluginImplSymFmt, ver))
+	err = &VersionMismatchError{Name: cfg.Name, Got: *version, Want: AAAPluginAPIVersion}
+	return nil, 0, err
+}
+
+// LookupSymbol looks up a symbol exported by the protocol's plugin file, for
+// plugins offering APIs beyond AAAPlugin, e.g. a metrics exporter. An error is
+// returned if the protocol was not loaded from a plugin file.
+//
+// The symbol is used directly, without the protection given to calls made by
+// this package: panics are not recovered, MaxConcurrentPluginCalls is not
+// applied, and the caller must assert the symbol's type itself. The symbol
+// remains valid after the protocol is reloaded or torn down, as plugins are
+// never unloaded, but it may then refer to state which is no longer set up.
+func (p *AAAProtocol) LookupSymbol(name string) (plugin.Symbol, error) {
+	if p.handle == nil {
+		return nil, fmt.Errorf("AAA protocol %s was not loaded from a plugin file",
+			p.Cfg.Name)
+	}
+	return p.handle.Lookup(name)
+}
+
+// Reads the named plugin config, which may be an entry of the merged config
+// file (see AAAPluginsMergedCfgFile), over the config defaults (see
+// AAAPluginsDefaultsCfgFile).
+func readAAAPluginConfig(cfgFS fs.FS, fn string) (AAAPluginConfig, error) {
+	defaults, err := readAAAPluginDefaults(cfgFS)
 	if err != nil {
-		err := fmt.Errorf("Could not lookup plugin V%d", ver)
-		return nil, err
+		return defaults, err
 	}
-	var aaaPlugin AAAPlugin
-	aaaPlugin, ok = symPlugin.(AAAPlugin)
-	if !ok {
-		err := fmt.Errorf("Unexpected type from "+aaaPluginImplSymFmt+" symbol", ver)
-		return nil, err
+
+	if isMergedCfgName(fn) {
+		return readMergedAAAPluginConfig(cfgFS, fn, defaults)
 	}
-	return aaaPlugin, nil
-}
 
-func loadAAAPlugin(fn string) (string, *AAAProtocol, error) {
-	var cfg AAAPluginConfig
-	var protocol AAAProtocol
-	f, e := os.Open(AAAPluginsCfgDir + fn)
+	if err := checkCfgFileConflict(cfgFS, fn); err != nil {
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	if err := checkCfgFileTarget(cfgFS, fn); err != nil {
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+
+	f, e := cfgFS.Open(fn)
 	if e != nil {
 		err := fmt.Errorf("Failed opening plugin config file: %s", e)
-		return "", nil, err
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	defer f.Close()
+
+	if isYAMLCfgFile(fn) {
+		return decodeYAMLAAAPluginConfig(limitCfgFile(f), defaults)
 	}
-	dec := json.NewDecoder(f)
-	e = dec.Decode(&cfg)
+	return decodeAAAPluginConfig(limitCfgFile(f), defaults)
+}
+
+// Decodes a plugin config over cfg, so that fields absent from the config keep
+// their value in cfg
+func decodeAAAPluginConfig(r io.Reader, cfg AAAPluginConfig) (AAAPluginConfig, error) {
+	e := newCfgDecoder(r).Decode(&cfg)
 	if e != nil {
-		err := fmt.Errorf("Failed to decode plugin config file: %s", e)
-		return "", nil, err
+		err := fmt.Errorf("Failed to decode plugin config file: %w", e)
+		return cfg, err
+	}
+	if e = cfg.Validate(); e != nil {
+		err := fmt.Errorf("Invalid plugin config file: %w", e)
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func openAAAPlugin(cfgFS fs.FS, pluginDir, fn string, cfg AAAPluginConfig) (*AAAProtocol, error) {
+	var protocol AAAProtocol
+
+	if err := checkPluginAllowed(cfg.Name); err != nil {
+		return nil, err
+	}
+	path, err := pluginPath(pluginDir, cfg.pluginFile())
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPluginChecksum(path, cfg); err != nil {
+		return nil, err
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		protocol.PluginModTime = fi.ModTime()
+	}
+	if fi, err := fs.Stat(cfgFS, cfgFileName(fn)); err == nil {
+		protocol.ConfigModTime = fi.ModTime()
 	}
 
-	aaaPlugin, e := plugin.Open(AAAPluginsDir + cfg.Name + ".so")
+	// The checksum is verified again as the plugin is opened, in case the
+	// file has been replaced since
+	aaaPlugin, sum, e := openPluginFile(path, cfg.Sha256)
+	var integrityErr *IntegrityError
+	if errors.As(e, &integrityErr) {
+		integrityErr.Name = cfg.Name
+		return nil, integrityErr
+	}
 	if e != nil {
 		err := fmt.Errorf("Could not load plugin: %v", e)
-		return "", nil, err
+		return nil, err
 	}
 
-	p, err := lookupPluginImpl(cfg.Name, aaaPlugin, AAAPluginAPIVersion)
+	p, version, err := lookupPluginImpl(cfg, aaaPlugin)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	protocol.Cfg = cfg
 	protocol.Plugin = p
+	protocol.APIVersion = version
+	protocol.cfgFile = fn
+	protocol.handle = aaaPlugin
+	protocol.pluginSum = sum
 
-	return cfg.Name, &protocol, nil
+	return &protocol, nil
 }
 
-func LoadAAA() (*AAA, error) {
-	var aaa AAA
+// Returns a nil protocol, without opening the plugin, if the config disables
+// the plugin or is not wanted.
+func loadAAAPlugin(cfgFS fs.FS, pluginDir, fn string,
+	want func(AAAPluginConfig) bool) (AAAPluginConfig, *AAAProtocol, error) {
+	cfg, err := readAAAPluginConfig(cfgFS, fn)
+	if err != nil || !cfg.IsEnabled() || !want(cfg) {
+		return cfg, nil, err
+	}
+
+	protocol, err := openAAAPlugin(cfgFS, pluginDir, fn, cfg)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	return cfg, protocol, nil
+}
+
+// Configures and sets up the protocol's plugin, giving up after SetupTimeout.
+//
+// A Setup which times out can not be interrupted, so is left to complete in
+// the background, after which the plugin is torn down since it will not be
+// used, unless a loaded protocol of a shares the plugin instance because it uses
+// the same symbol of an unchanged binary. Any error doing so is logged.
+func (a *AAA) setupAAAProtocol(ctx context.Context, name string,
+	protocol *AAAProtocol) error {
+	logger := a.log()
+	caps := protocol.Capabilities()
+	setup := func() error {
+		return callPlugin(func() error {
+			if caps.Configure {
+				c := unwrapAAAPlugin(protocol.Plugin).(AAAPluginConfigurer)
+				if err := c.Configure(protocol.Cfg.Settings); err != nil {
+					return err
+				}
+			}
+			return protocol.Plugin.Setup()
+		})
+	}
+
+	parent := ctx
+	if SetupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SetupTimeout)
+		defer cancel()
+	}
+
+	var err error
+	if ctx.Done() == nil {
+		err = setup()
+	} else {
+		ch := make(chan error)
+		timedOut := make(chan struct{})
+		go func() {
+			err := setup()
+			select {
+			case ch <- err:
+			case <-timedOut:
+				if a.pluginInUse(protocol) {
+					return
+				}
+				if err := teardownAAAProtocol(name, protocol); err != nil {
+					logger.Printf("%v", err)
+				}
+			}
+		}()
+
+		select {
+		case err = <-ch:
+		case <-ctx.Done():
+			close(timedOut)
+			if err = parent.Err(); err == nil {
+				err = fmt.Errorf("Timed out after %s", SetupTimeout)
+			}
+		}
+	}
 
-	aaa.Protocols = make(map[string]*AAAProtocol)
+	if err != nil {
+		return fmt.Errorf("Error setting up plugin %s: %w", name, err)
+	}
+	if PingOnSetup {
+		protocol.pingBackend(name, logger)
+	}
+	return nil
+}
 
-	dir, err := os.Open(AAAPluginsCfgDir)
+func teardownAAAProtocol(name string, protocol *AAAProtocol) error {
+	if !protocol.Capabilities().Teardown {
+		return nil
+	}
+	t := unwrapAAAPlugin(protocol.Plugin).(AAAPluginTeardown)
+	err := callPlugin(t.Teardown)
 	if err != nil {
+		return fmt.Errorf("Error tearing down plugin %s: %s", name, err)
+	}
+	return nil
+}
+
+// Returns the names of all plugin config files in the root of cfgFS, sorted
+// lexically. A missing config directory contains no config files. Symlinks are
+// included, and checked when the config is read, see checkCfgFileTarget. The
+// defaults file is not a config file, see AAAPluginsDefaultsCfgFile.
+func readAAAPluginsCfgDir(cfgFS fs.FS) ([]string, error) {
+	files, err := fs.ReadDir(cfgFS, ".")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
 		return nil, err
 	}
-	defer dir.Close()
 
-	files, err := dir.Readdir(-1)
+	var names []string
+	for _, file := range files {
+		if isCfgFileEntry(file) && file.Name() != AAAPluginsDefaultsCfgFile {
+			if isCfgFile(file.Name()) {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func checkAAADir(desc, dir string) error {
+	fi, err := os.Stat(dir)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("AAA %s directory %s does not exist", desc, dir)
+		}
+		return fmt.Errorf("Failed to access AAA %s directory %s: %s", desc, dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("AAA %s directory %s is not a directory", desc, dir)
+	}
+	return nil
+}
+
+// LoadAAA loads and sets up the AAA plugins configured in AAAPluginsCfgDir,
+// from AAAPluginsDir, unless overridden by RelativeToExecutable,
+// EnvAAAPluginsCfgDir or EnvAAAPluginsDir.
+func LoadAAA() (*AAA, error) {
+	return LoadAAAFrom(defaultAAADirs())
+}
+
+// LoadAAAWithLogger is like LoadAAA, but reports problems to logger instead
+// of the standard logger. A nil logger selects the standard logger.
+func LoadAAAWithLogger(logger Logger) (*AAA, error) {
+	cfgDir, pluginDir := defaultAAADirs()
+	return loadAAA(cfgDir, pluginDir, loadOptions{logger: logger})
+}
+
+// LoadAAAAccounting is like LoadAAA, but only loads plugins with command
+// accounting enabled. Other plugins are not opened at all, which saves
+// resources for consumers which only account tasks. This also applies to
+// subsequent reloads.
+func LoadAAAAccounting() (*AAA, error) {
+	cfgDir, pluginDir := defaultAAADirs()
+	return loadAAA(cfgDir, pluginDir, loadOptions{acctOnly: true})
+}
+
+// LoadAAAFrom loads and sets up the AAA plugins configured in cfgDir, from
+// pluginDir.
+//
+// If cfgDir does not exist no plugins are configured, and an AAA with no
+// protocols is returned. Otherwise pluginDir must also exist.
+//
+// Configs are loaded in lexical order of their file names, so the load order
+// can be controlled by prefixing them, e.g. 10-tacplus.json, 20-radius.json.
+// Configs may be written in JSON (.json), or with the same keys in YAML
+// (.yaml or .yml). If config files with the same base name exist in several
+// formats, the first of .json, .yaml and .yml is used and the others are
+// reported as errors. A merged config file may also be used, see
+// AAAPluginsMergedCfgFile.
+// If several configs declare the same plugin name, the first is used and a
+// DuplicatePluginError is reported for each of the others.
+//
+// Plugins which fail to load are skipped and reported in a LoadErrors error,
+// along with a usable AAA containing the protocols which did load, unless
+// StrictLoad is set. Configs enabling neither command accounting nor command
+// authorization are skipped with a warning, see ErrPluginDoesNothing.
+func LoadAAAFrom(cfgDir, pluginDir string) (*AAA, error) {
+	return loadAAA(cfgDir, pluginDir, loadOptions{})
+}
+
+// LoadAAAFS is like LoadAAAFrom, but reads plugin configs from the root of
+// cfgFS. Plugins are still loaded from pluginDir, which must exist.
+func LoadAAAFS(cfgFS fs.FS, pluginDir string) (*AAA, error) {
+	return loadAAAFS(cfgFS, pluginDir, loadOptions{})
+}
+
+// LoadAAACtx is like LoadAAA, but gives up loading once ctx is done, e.g. to
+// enforce a startup deadline. Plugins not yet loaded are skipped, and the AAA
+// containing the protocols which did load is returned along with ctx.Err(),
+// unless StrictLoad is set. A plugin being set up when ctx is done is torn
+// down once its setup completes, as for SetupTimeout.
+func LoadAAACtx(ctx context.Context) (*AAA, error) {
+	cfgDir, pluginDir := defaultAAADirs()
+	return loadAAA(cfgDir, pluginDir, loadOptions{ctx: ctx})
+}
+
+type loadOptions struct {
+	logger   Logger
+	acctOnly bool
+	// Context loading is abandoned on, if any
+	ctx context.Context
+}
+
+// Returns an AAA with no protocols, which loads from the given locations
+func newLoadedAAA(cfgFS fs.FS, pluginDir string, opts loadOptions) *AAA {
+	aaa := &AAA{
+		Protocols: make(map[string]*AAAProtocol),
+		cfgFS:     cfgFS,
+		pluginDir: pluginDir,
+		logger:    opts.logger,
+		acctOnly:  opts.acctOnly,
+		disabled:  make(map[string]AAAPluginConfig),
+	}
+	if aaa.logger == nil {
+		aaa.logger = stdLogger{}
+	}
+	return aaa
+}
+
+func loadAAA(cfgDir, pluginDir string, opts loadOptions) (*AAA, error) {
+	cfgFS := newCfgDirFS(cfgDir)
+	if _, err := os.Stat(cfgDir); os.IsNotExist(err) {
+		return newLoadedAAA(cfgFS, pluginDir, opts), nil
+	}
+	if err := checkAAADir("plugin config", cfgDir); err != nil {
+		return nil, err
+	}
+	return loadAAAFS(cfgFS, pluginDir, opts)
+}
+
+func loadAAAFS(cfgFS fs.FS, pluginDir string, opts loadOptions) (*AAA, error) {
+	aaa := newLoadedAAA(cfgFS, pluginDir, opts)
+	logger := aaa.logger
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := checkAAADir("plugin", pluginDir); err != nil {
 		return nil, err
 	}
 
+	files, err := readAAAPluginCfgNames(cfgFS)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs LoadErrors
+	var versionMismatches int
+	names := make(pluginNames)
+	abandon := func() (*AAA, error) {
+		err := ctx.Err()
+		logger.Printf("Abandoned loading AAA plugins: %v", err)
+		if StrictLoad {
+			aaa.teardown()
+			return nil, err
+		}
+		return aaa, err
+	}
+
 	for _, file := range files {
-		if file.Mode().IsRegular() {
-			if filepath.Ext(file.Name()) == ".json" {
-				name, protocol, err := loadAAAPlugin(file.Name())
-				if err != nil {
-					log.Print(err)
-					continue
-				}
-				err = guard.CatchPanicErrorOnly(func() error {
-					return protocol.Plugin.Setup()
-				})
-				if err != nil {
-					log.Print(fmt.Sprintf("Error setting up plugin %s: %s", name, err))
-					continue
-				}
-				aaa.Protocols[name] = protocol
+		if ctx.Err() != nil {
+			return abandon()
+		}
+
+		cfg, err := readAAAPluginConfig(cfgFS, file)
+		if skipDoingNothing(logger, file, err, StrictLoad) {
+			continue
+		}
+		if err == nil {
+			err = names.claim(cfg.Name, file)
+		}
+		if err == nil && !cfg.IsEnabled() {
+			aaa.disabled[cfg.Name] = cfg
+			continue
+		}
+		if err == nil && !aaa.wants(cfg) {
+			continue
+		}
+
+		var protocol *AAAProtocol
+		if err == nil {
+			protocol, err = openAAAPlugin(cfgFS, pluginDir, file, cfg)
+		}
+		if err == nil {
+			err = aaa.setupAAAProtocol(ctx, cfg.Name, protocol)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return abandon()
+			}
+			var verErr *VersionMismatchError
+			if errors.As(err, &verErr) {
+				versionMismatches++
+			}
+			err = fmt.Errorf("%s: %w", file, err)
+			logger.Printf("%v", err)
+			errs = append(errs, err)
+			aaa.failed = append(aaa.failed, failedEvent(cfg, file, err))
+			if StrictLoad {
+				aaa.teardown()
+				return nil, errs
+			}
+			continue
+		}
+		aaa.addLoadedProtocol(cfg.Name, protocol)
+	}
+
+	if versionMismatches > 0 {
+		logger.Printf("Skipped %d plugin(s) built against an unsupported plugin API version",
+			versionMismatches)
+	}
+
+	if len(errs) > 0 {
+		return aaa, errs
+	}
+	return aaa, nil
+}
+
+// Adds protocol, once set up, to the protocols being loaded. The lock is
+// taken as the Setup of a protocol which timed out may still complete and
+// check which plugins are in use.
+func (a *AAA) addLoadedProtocol(name string, protocol *AAAProtocol) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.Protocols[name] = protocol
+}
+
+// Tears down all protocols, reporting any errors to the logger
+func (a *AAA) teardown() {
+	for _, protocol := range a.OrderedProtocols() {
+		if err := teardownAAAProtocol(protocol.Cfg.Name, protocol); err != nil {
+			a.log().Printf("%v", err)
+		}
+	}
+}
+
+// ValidateAAA checks that the AAA plugins configured in cfgDir can be loaded
+// from pluginDir, without calling their Setup method. An error is returned
+// for each config which fails to load, including those which would be skipped
+// by LoadAAA because they enable nothing (see ErrPluginDoesNothing).
+//
+// Note that opening a plugin still runs any init functions it contains.
+func ValidateAAA(cfgDir, pluginDir string) []error {
+	if err := checkAAADir("plugin config", cfgDir); err != nil {
+		return []error{err}
+	}
+	if err := checkAAADir("plugin", pluginDir); err != nil {
+		return []error{err}
+	}
+
+	cfgFS := newCfgDirFS(cfgDir)
+	files, err := readAAAPluginCfgNames(cfgFS)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	names := make(pluginNames)
+	for _, file := range files {
+		cfg, _, err := loadAAAPlugin(cfgFS, pluginDir, file,
+			func(AAAPluginConfig) bool { return true })
+		if err == nil {
+			err = names.claim(cfg.Name, file)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+	}
+	return errs
+}
+
+// Protocol returns the loaded protocol with the given name, if any.
+func (a *AAA) Protocol(name string) (*AAAProtocol, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	protocol, ok := a.Protocols[name]
+	return protocol, ok
+}
+
+// ProtocolNames returns the names of the loaded protocols, sorted lexically.
+// Unlike OrderedProtocols the order does not depend on priorities.
+func (a *AAA) ProtocolNames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.Protocols))
+	for name := range a.Protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForEachProtocol calls fn for each loaded protocol, in the same order as
+// OrderedProtocols, stopping at and returning the first error returned by fn.
+//
+// A read lock is held for the duration, so fn must not call Reload.
+func (a *AAA) ForEachProtocol(fn func(*AAAProtocol) error) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, protocol := range a.orderedProtocols() {
+		if err := fn(protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrderedProtocols returns the loaded protocols in the order they should be
+// consulted: ascending by priority, with ties broken by name.
+func (a *AAA) OrderedProtocols() []*AAAProtocol {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.orderedProtocols()
+}
+
+// Must be called with a.mu held
+func (a *AAA) orderedProtocols() []*AAAProtocol {
+	protocols := make([]*AAAProtocol, 0, len(a.Protocols))
+	for _, protocol := range a.Protocols {
+		protocols = append(protocols, protocol)
+	}
+	sort.Slice(protocols, func(i, j int) bool {
+		if protocols[i].Cfg.Priority != protocols[j].Cfg.Priority {
+			return protocols[i].Cfg.Priority < protocols[j].Cfg.Priority
+		}
+		return protocols[i].Cfg.Name < protocols[j].Cfg.Name
+	})
+	return protocols
+}
+
+// Returns the logger of a, falling back to the standard logger if a was not
+// created by one of the LoadAAA functions.
+func (a *AAA) log() Logger {
+	if a.logger == nil {
+		return stdLogger{}
+	}
+	return a.logger
+}
+
+// Reports whether a plugin with the given config should be loaded into a
+func (a *AAA) wants(cfg AAAPluginConfig) bool {
+	return !a.acctOnly || cfg.CmdAcct
+}
+
+// Returns where a loads plugin configs and plugins from, falling back to the
+// defaults used by LoadAAA if a was not created by one of the LoadAAA
+// functions.
+func (a *AAA) dirs() (fs.FS, string) {
+	cfgFS, pluginDir := a.cfgFS, a.pluginDir
+	defCfgDir, defPluginDir := defaultAAADirs()
+	if cfgFS == nil {
+		cfgFS = newCfgDirFS(defCfgDir)
+	}
+	if pluginDir == "" {
+		pluginDir = defPluginDir
+	}
+	return cfgFS, pluginDir
+}
+
+// Reload re-scans the plugin config directory and brings the loaded protocols
+// in line with the configs found there. Protocols which were not loaded from
+// the config directory (see NewAAA) are left in place; configs declaring the
+// name of one fail with a DuplicatePluginError.
+//
+// Plugins for new configs are loaded and set up, and protocols whose configs
+// have been removed or disabled are dropped. Protocols whose config and plugin
+// binary are unchanged are kept as they are, without re-opening or re-setting
+// up the plugin.
+// A protocol whose config or plugin binary has changed is loaded afresh; if
+// that fails the previously loaded instance is retained. See openPluginFile
+// for the restrictions on loading a replaced plugin binary. If only the config
+// has changed the plugin is not re-opened, so the new config is applied to the
+// plugin of the previously loaded instance, which is shared by both: a
+// retained instance may be left with its plugin partly reconfigured.
+// Protocols which are removed or replaced are torn down, if supported by the
+// plugin (see AAAPluginTeardown), unless another protocol was set up on the
+// same plugin instance: the same symbol (see AAAPluginConfig.Symbol) of an
+// unchanged binary.
+//
+// Plugins which fail to load are skipped and reported in a LoadErrors error;
+// all other protocols remain usable. If StrictReload is set, any failure
+// instead abandons the reload: the protocols set up by it are torn down and the
+// set of loaded protocols is left as it was. Protocols sharing their plugin
+// with a loaded protocol are not torn down, and reconfiguring their plugin is
+// not undone, so the rollback is only exact for protocols whose plugin binary
+// has changed or which are new.
+//
+// In either case the new set of protocols is swapped in as a whole, and
+// protocols which it no longer contains are only torn down afterwards.
+func (a *AAA) Reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	cfgFS, pluginDir := a.dirs()
+
+	files, err := readAAAPluginCfgNames(cfgFS)
+	if err != nil {
+		return err
+	}
+
+	var errs LoadErrors
+	protocols := make(map[string]*AAAProtocol)
+	disabled := make(map[string]AAAPluginConfig)
+	kept := make(map[*AAAProtocol]bool)
+
+	loaded := make(map[string]*AAAProtocol)
+	a.mu.RLock()
+	for name, protocol := range a.Protocols {
+		if protocol.cfgFile == "" {
+			protocols[name] = protocol
+			kept[protocol] = true
+			continue
+		}
+		loaded[protocol.cfgFile] = protocol
+	}
+	names := inProcessPluginNames(a.Protocols)
+	a.mu.RUnlock()
+
+	var failed []ChangeEvent
+	for _, file := range files {
+		old := loaded[file]
+
+		cfg, err := readAAAPluginConfig(cfgFS, file)
+		if skipDoingNothing(a.log(), file, err, StrictReload) {
+			continue
+		}
+		if err == nil {
+			if err := names.claim(cfg.Name, file); err != nil {
+				// Not worth keeping old, as its name is taken
+				err = fmt.Errorf("%s: %w", file, err)
+				a.log().Printf("%v", err)
+				errs = append(errs, err)
+				failed = append(failed, failedEvent(cfg, file, err))
+				continue
+			}
+		}
+		if err == nil && old != nil && reflect.DeepEqual(old.Cfg, cfg) &&
+			!old.pluginChanged(pluginDir) {
+			protocols[old.Cfg.Name] = old
+			kept[old] = true
+			continue
+		}
+		if err == nil && !cfg.IsEnabled() {
+			disabled[cfg.Name] = cfg
+			continue
+		}
+		if err == nil && !a.wants(cfg) {
+			continue
+		}
+
+		var protocol *AAAProtocol
+		if err == nil {
+			protocol, err = openAAAPlugin(cfgFS, pluginDir, file, cfg)
+		}
+		if err == nil {
+			err = a.setupAAAProtocol(context.Background(), cfg.Name, protocol)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", file, err)
+			a.log().Printf("%v", err)
+			errs = append(errs, err)
+			failed = append(failed, failedEvent(cfg, file, err))
+			if old != nil {
+				protocols[old.Cfg.Name] = old
+				kept[old] = true
+			}
+			continue
+		}
+		protocols[cfg.Name] = protocol
+	}
+
+	if StrictReload && len(errs) > 0 {
+		a.mu.RLock()
+		inUse := pluginsInUse(a.Protocols)
+		a.mu.RUnlock()
+		for name, protocol := range protocols {
+			if kept[protocol] || inUse[protocol.instance()] {
+				continue
 			}
+			if err := teardownAAAProtocol(name, protocol); err != nil {
+				a.log().Printf("%v", err)
+			}
+		}
+		a.mu.Lock()
+		a.failed = failed
+		a.mu.Unlock()
+		a.notify(failed)
+		return errs
+	}
+
+	a.mu.Lock()
+	previous := a.Protocols
+	a.Protocols = protocols
+	a.disabled = disabled
+	a.failed = failed
+	a.mu.Unlock()
+	a.FlushAuthzCache()
+	a.applyDebug()
+
+	inUse := pluginsInUse(protocols)
+	for name, protocol := range previous {
+		if kept[protocol] || inUse[protocol.instance()] {
+			continue
+		}
+		if err := teardownAAAProtocol(name, protocol); err != nil {
+			a.log().Printf("%v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	a.notify(append(diffProtocols(previous, protocols), failed...))
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Identifies the plugin instance of a protocol loaded from a plugin file: the
+// plugin opened and the symbol exporting the instance. Protocols sharing a
+// plugin file have separate instances unless they use the same symbol.
+type pluginInstance struct {
+	handle *plugin.Plugin
+	symbol string
+}
+
+func (p *AAAProtocol) instance() pluginInstance {
+	symbol := p.Cfg.Symbol
+	if symbol == "" {
+		symbol = fmt.Sprintf(aaaPluginImplSymFmt, p.APIVersion)
+	}
+	return pluginInstance{handle: p.handle, symbol: symbol}
+}
+
+// Returns the plugin instances used by protocols
+func pluginsInUse(protocols map[string]*AAAProtocol) map[pluginInstance]bool {
+	inUse := make(map[pluginInstance]bool)
+	for _, protocol := range protocols {
+		if protocol.handle != nil {
+			inUse[protocol.instance()] = true
+		}
+	}
+	return inUse
+}
+
+// Reports whether the plugin instance of protocol is that of a loaded
+// protocol of a
+func (a *AAA) pluginInUse(protocol *AAAProtocol) bool {
+	if protocol.handle == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return pluginsInUse(a.Protocols)[protocol.instance()]
+}
+
+// ReloadProtocol reloads the named protocol from its config file, re-opening
+// the plugin and setting it up before swapping it in place of the current
+// instance, which is then torn down unless the new instance uses the same
+// symbol of an unchanged plugin binary.
+//
+// If the reload fails the current instance is left in place. If the plugin
+// binary is unchanged though, the plugin is not re-opened and the new
+// instance shares the plugin of the current one, which is then left
+// configured and set up with the new config as far as that got. If the
+// config now disables the plugin, or it is otherwise no longer wanted (see
+// LoadAAAAccounting), the protocol is removed.
+//
+// The config file may not name a different protocol, e.g. after the entries
+// of the merged config file have been reordered; use Reload to pick up such
+// changes.
+func (a *AAA) ReloadProtocol(name string) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	old, ok := a.Protocol(name)
+	if !ok {
+		return fmt.Errorf("Unknown AAA protocol %s", name)
+	}
+	if old.cfgFile == "" {
+		return fmt.Errorf("AAA protocol %s was not loaded from a config file", name)
+	}
+
+	cfgFS, pluginDir := a.dirs()
+	cfg, err := readAAAPluginConfig(cfgFS, old.cfgFile)
+	if err == nil && cfg.Name != name {
+		err = a.renamedProtocolError(name, cfg.Name)
+	}
+	var protocol *AAAProtocol
+	if err == nil && cfg.IsEnabled() && a.wants(cfg) {
+		protocol, err = openAAAPlugin(cfgFS, pluginDir, old.cfgFile, cfg)
+	}
+	if err == nil && protocol != nil {
+		err = a.setupAAAProtocol(context.Background(), cfg.Name, protocol)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", old.cfgFile, err)
+		a.notify([]ChangeEvent{{Name: name, Kind: ChangeFailed, Err: err}})
+		return err
+	}
+
+	a.mu.Lock()
+	delete(a.Protocols, name)
+	if protocol != nil {
+		a.Protocols[cfg.Name] = protocol
+	} else if !cfg.IsEnabled() {
+		if a.disabled == nil {
+			a.disabled = make(map[string]AAAPluginConfig)
 		}
+		a.disabled[cfg.Name] = cfg
+	}
+	a.mu.Unlock()
+	a.FlushAuthzCache()
+	a.applyDebug()
+
+	if protocol == nil || protocol.instance() != old.instance() {
+		err = teardownAAAProtocol(name, old)
 	}
 
-	return &aaa, nil
+	current := make(map[string]*AAAProtocol)
+	if protocol != nil {
+		current[cfg.Name] = protocol
+	}
+	a.notify(diffProtocols(map[string]*AAAProtocol{name: old}, current))
+
+	return err
+}
+
+// Returns the error for a protocol's config file naming another protocol,
+// which is a DuplicatePluginError if that protocol is loaded
+func (a *AAA) renamedProtocolError(name, newName string) error {
+	if other, ok := a.Protocol(newName); ok {
+		return &DuplicatePluginError{Name: newName, FirstFile: other.cfgFile}
+	}
+	return fmt.Errorf("Plugin config now names plugin %s instead of %s", newName, name)
 }
@@ -0,0 +1,186 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Number of records AccountAsync queues before dropping further records
+var AsyncAcctQueueSize = 1024
+
+// AsyncAcctStats counts the records passed to AccountAsync
+type AsyncAcctStats struct {
+	Queued    uint64 `json:"queued"`
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`
+	// Not queued because the queue was full or AAA is draining
+	Dropped uint64 `json:"dropped"`
+}
+
+// Queue of records accounted in the background, see AccountAsync
+type asyncAcct struct {
+	once  sync.Once
+	queue chan asyncAcctItem
+	stop  chan struct{}
+
+	// Protects the fields below. Held for reading while queueing.
+	mu       sync.RWMutex
+	draining bool
+	stats    AsyncAcctStats
+}
+
+// A record to account, or a request to be notified once the records queued
+// before it have been processed
+type asyncAcctItem struct {
+	rec     AccountRecord
+	flushed chan struct{}
+}
+
+// Starts the worker of a's queue, if not already started
+func (a *AAA) asyncQueue() *asyncAcct {
+	q := &a.async
+	q.once.Do(func() {
+		q.queue = make(chan asyncAcctItem, AsyncAcctQueueSize)
+		q.stop = make(chan struct{})
+		go a.asyncWorker(q)
+	})
+	return q
+}
+
+func (a *AAA) asyncWorker(q *asyncAcct) {
+	for {
+		select {
+		case item := <-q.queue:
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			err := a.deliverRecord(item.rec)
+			if err != nil {
+				a.log().Printf("Failed to account record of task %s%s: %v",
+					item.rec.TaskID, logRequestID(item.rec.Env[EnvRequestID]), err)
+			}
+			q.mu.Lock()
+			if err != nil {
+				q.stats.Failed++
+			} else {
+				q.stats.Delivered++
+			}
+			q.mu.Unlock()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Passes rec to the protocol which accounts the tasks of its user, retrying as
+// described for NewRetryingTask
+func (a *AAA) deliverRecord(rec AccountRecord) error {
+	protocol, err := a.accountingProtocol(rec.Context, rec.UID, rec.Groups)
+	if err != nil {
+		return err
+	}
+	if !protocol.Capabilities().AccountRecord {
+		return fmt.Errorf("Plugin %s does not support account records", protocol.Cfg.Name)
+	}
+
+	return retryAcct(protocol.Cfg.AcctRetries, protocol.acctRetryDelay(), func() error {
+		return protocol.accountRecord(rec)
+	})
+}
+
+// AccountAsync queues rec to be accounted in the background, returning
+// immediately. It is intended for paths whose latency must not depend on that
+// of the accounting servers.
+//
+// The record is passed to the protocol PluginForUser would return for its
+// context, whose plugin must implement AAAPluginAccountRecord, retrying as for
+// NewRetryingTask. Failures are logged. The context is normalized and a task
+// ID assigned if rec has none. Path should already be redacted, see
+// RedactPath.
+//
+// At most AsyncAcctQueueSize records are queued; further records are dropped
+// until the queue drains, as are records passed once Drain has been called.
+// See AsyncAcctStats for the number of records dropped, and Flush for waiting
+// for the queued records to be accounted.
+func (a *AAA) AccountAsync(rec AccountRecord) {
+	rec.Context = normalizeContext(rec.Context)
+	if rec.TaskID == "" {
+		rec.TaskID = newTaskID()
+	}
+
+	q := a.asyncQueue()
+	q.mu.RLock()
+	queued := false
+	if !q.draining {
+		select {
+		case q.queue <- asyncAcctItem{rec: rec}:
+			queued = true
+		default:
+		}
+	}
+	q.mu.RUnlock()
+
+	q.mu.Lock()
+	if queued {
+		q.stats.Queued++
+	} else {
+		q.stats.Dropped++
+	}
+	q.mu.Unlock()
+}
+
+// Flush waits for the records queued by AccountAsync before it was called to
+// be accounted, or for ctx to be done, in which case its error is returned.
+// Once Drain has flushed the queue Flush returns immediately.
+func (a *AAA) Flush(ctx context.Context) error {
+	q := a.asyncQueue()
+	flushed := make(chan struct{})
+	select {
+	case q.queue <- asyncAcctItem{flushed: flushed}:
+	case <-q.stop:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+	case <-q.stop:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// AsyncAcctStats returns the counters of the records passed to AccountAsync
+func (a *AAA) AsyncAcctStats() AsyncAcctStats {
+	q := &a.async
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.stats
+}
+
+// Stops AccountAsync queueing records, then flushes the queue as for Flush and
+// stops its worker
+func (a *AAA) drainAsync(ctx context.Context) error {
+	q := a.asyncQueue()
+	q.mu.Lock()
+	draining := q.draining
+	q.draining = true
+	q.mu.Unlock()
+	if draining {
+		return nil
+	}
+
+	err := a.Flush(ctx)
+	close(q.stop)
+	return err
+}
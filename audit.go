@@ -0,0 +1,102 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+	"time"
+)
+
+// AuthzOutcome describes how the path of an accounted task was authorized,
+// see AccountRecord.Authorization
+type AuthzOutcome string
+
+const (
+	// A protocol authorized the path
+	AuthzOutcomeAuthorized AuthzOutcome = "authorized"
+	// The path was not authorized, or authorizing it failed
+	AuthzOutcomeDenied AuthzOutcome = "denied"
+	// The path was authorized without any protocol deciding, because no
+	// protocol with command authorization enabled was loaded and the
+	// DefaultDecision allowed it
+	AuthzOutcomeUngated AuthzOutcome = "ungated"
+	// No authorization of the path was seen
+	AuthzOutcomeUnchecked AuthzOutcome = "unchecked"
+)
+
+// AuthzAuditOptions configures the linking of accounted tasks to the
+// authorization of their paths, for compliance reporting of commands which ran
+// without being authorized. See SetAuthzAudit.
+type AuthzAuditOptions struct {
+	// Maximum number of authorization decisions remembered; zero disables
+	// auditing. The oldest decision is forgotten when full.
+	Size int
+	// Time for which a decision is remembered, which should cover the time
+	// between authorizing a command and starting its accounting; zero means
+	// until forgotten
+	Window time.Duration
+}
+
+// SetAuthzAudit enables auditing of authorization: each decision made by
+// Authorize and its variants is remembered, and the AccountRecord of a task
+// accounted for the same context, user, groups and path records its outcome
+// as AccountRecord.Authorization. Tasks for which no decision is remembered are
+// recorded as AuthzOutcomeUnchecked. Decisions made by AuthorizeAny and
+// AAAProtocol.AuthorizeCtx are not remembered.
+func (a *AAA) SetAuthzAudit(opts AuthzAuditOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if opts.Size <= 0 {
+		a.authzAudit = nil
+		return
+	}
+	a.authzAudit = newAuthzCache(AuthzCacheOptions{
+		Size:         opts.Size,
+		TTL:          opts.Window,
+		CacheSecrets: true,
+	})
+}
+
+func (a *AAA) getAuthzAudit() *authzCache {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.authzAudit
+}
+
+// Remembers the decision, if auditing is enabled
+func (a *AAA) auditAuthz(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs, d authzDecision) {
+	audit := a.getAuthzAudit()
+	if audit == nil {
+		return
+	}
+	key, _ := audit.key(context, uid, groups, path, pathAttrs)
+	audit.put(key, d)
+}
+
+// Returns the outcome of the last remembered authorization of the path, or
+// the empty string if auditing is disabled
+func (a *AAA) authzOutcome(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) AuthzOutcome {
+	audit := a.getAuthzAudit()
+	if audit == nil {
+		return ""
+	}
+
+	key, _ := audit.key(context, uid, groups, path, pathAttrs)
+	d, ok := audit.get(key)
+	switch {
+	case !ok:
+		return AuthzOutcomeUnchecked
+	case !d.authorized || d.err != nil:
+		return AuthzOutcomeDenied
+	case d.source == "":
+		return AuthzOutcomeUngated
+	}
+	return AuthzOutcomeAuthorized
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+// Authenticate attempts to authenticate user with each protocol in turn, in
+// the order given by OrderedProtocols, returning true on the first success.
+//
+// Protocols which do not support authentication (see Capabilities), or
+// return ErrAuthNotSupported, are skipped. Protocols returning any other
+// error are also skipped, with the last such error being returned if no
+// protocol authenticates the user. ErrAuthNotSupported is returned if
+// none of the protocols support authentication.
+func (a *AAA) Authenticate(context string, user string, credentials map[string]string) (bool, error) {
+	context = normalizeContext(context)
+	var lastErr error
+	var supported bool
+
+	for _, protocol := range a.OrderedProtocols() {
+		if !protocol.Capabilities().Authenticate {
+			continue
+		}
+		ok, err := protocol.authenticate(context, user, credentials)
+		if err == ErrAuthNotSupported {
+			continue
+		}
+		supported = true
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	if !supported {
+		return false, ErrAuthNotSupported
+	}
+	return false, lastErr
+}
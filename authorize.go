@@ -0,0 +1,287 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+)
+
+// AAAPluginReason may optionally be implemented by an AAAPlugin to explain its
+// authorization decisions, e.g. "not in allowed command set".
+type AAAPluginReason interface {
+	// As for AAAPlugin.Authorize, additionally returning a human-readable
+	// reason for the decision, which may be empty.
+	AuthorizeWithReason(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs) (bool, string, error)
+}
+
+// AuthzMode selects how the decisions of several protocols are combined
+type AuthzMode int
+
+const (
+	// Path is authorized by the first protocol which authorizes it
+	FirstAllow AuthzMode = iota
+	// Path is authorized only if every protocol consulted authorizes it,
+	// and any protocol denying it denies it
+	RequireAll
+)
+
+// DefaultDecision is the authorization decision when no loaded protocol with
+// command authorization enabled applies to the context
+type DefaultDecision int
+
+const (
+	DenyWhenNoProtocols DefaultDecision = iota
+	AllowWhenNoProtocols
+)
+
+// AuthzPolicy configures how Authorize and its variants combine the
+// decisions of the protocols consulted. The zero value selects FirstAllow and
+// DenyWhenNoProtocols.
+type AuthzPolicy struct {
+	Mode AuthzMode
+	// Decision when no loaded protocol with command authorization enabled
+	// applies to the context, also applied by AuthorizeAny and
+	// AuthorizeBatch
+	Default DefaultDecision
+	// In RequireAll mode, whether protocols returning an error are skipped
+	// rather than treated as denying the path. If all protocols are
+	// skipped the last error is returned, as for FirstAllow.
+	SkipErrors bool
+	// Whether protocols which failed their last health check (see
+	// CheckHealth) are skipped by Authorize and its variants, as though
+	// they returned an error wrapping ErrProtocolUnhealthy. Protocols are
+	// healthy until checked.
+	SkipUnhealthy bool
+}
+
+// SetAuthzPolicy sets how the decisions of the protocols are combined, and
+// flushes the authorization cache. AuthorizeAny is unaffected by the Mode.
+func (a *AAA) SetAuthzPolicy(policy AuthzPolicy) {
+	a.mu.Lock()
+	a.authzPolicy = policy
+	a.mu.Unlock()
+
+	a.FlushAuthzCache()
+}
+
+func (a *AAA) getAuthzPolicy() AuthzPolicy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.authzPolicy
+}
+
+// Outcome of an authorization request across protocols
+type authzDecision struct {
+	authorized bool
+	source     string
+	reason     string
+	err        error
+}
+
+// Authorize authorizes path with each protocol with command authorization
+// enabled, which applies to the context and is valid for the user, in turn,
+// in the order given by OrderedProtocols, returning true on the first protocol
+// which authorizes it. See AAAPlugin.Authorize for a description of the
+// parameters, and SetAuthzPolicy for requiring all protocols to authorize
+// path instead.
+//
+// The context is normalized as for NormalizeContext, if known. As described
+// for AAAPlugin.Authorize, a protocol returning an error is skipped and the
+// next protocol consulted. If no protocol made a decision because they all
+// returned an error, the last error is returned.
+//
+// If no loaded protocol with command authorization enabled applies to the
+// context, e.g. because AAA is not configured, the policy's DefaultDecision
+// applies. By default path is then not authorized.
+func (a *AAA) Authorize(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (bool, error) {
+	d := a.authorize(context, uid, groups, path, pathAttrs)
+	return d.authorized, d.err
+}
+
+// AuthorizeWithSource is like Authorize, but also returns the name of the
+// protocol which made the decision. If path is not authorized this is the
+// last protocol consulted, or empty if no protocol was consulted.
+func (a *AAA) AuthorizeWithSource(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs) (authorized bool, source string, err error) {
+	d := a.authorize(context, uid, groups, path, pathAttrs)
+	return d.authorized, d.source, d.err
+}
+
+// AuthorizeWithReason is like Authorize, but also returns the reason given for
+// the decision by the protocol which made it. The reason is empty if the
+// protocol's plugin does not implement AAAPluginReason.
+func (a *AAA) AuthorizeWithReason(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs) (authorized bool, reason string, err error) {
+	d := a.authorize(context, uid, groups, path, pathAttrs)
+	return d.authorized, d.reason, d.err
+}
+
+// Audits the decision made, if enabled, see SetAuthzAudit
+func (a *AAA) authorize(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) authzDecision {
+	context = normalizeContext(context)
+	d := a.decide(context, uid, groups, path, pathAttrs)
+	a.auditAuthz(context, uid, groups, path, pathAttrs, d)
+	return d
+}
+
+// Consults the authorization cache, if enabled, before the protocols, subject
+// to the rate limit (see SetAuthzRateLimit)
+func (a *AAA) decide(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) authzDecision {
+	if !a.hasAuthzProtocol(context) {
+		return a.defaultDecision()
+	}
+
+	cache := a.getAuthzCache()
+	if cache == nil {
+		if err := a.limitAuthz(uid); err != nil {
+			return authzDecision{err: err}
+		}
+		return a.authorizeProtocols(context, uid, groups, path, pathAttrs)
+	}
+
+	key, cacheable := cache.key(context, uid, groups, path, pathAttrs)
+	if cacheable {
+		if d, ok := cache.get(key); ok {
+			return d
+		}
+	}
+	if err := a.limitAuthz(uid); err != nil {
+		return authzDecision{err: err}
+	}
+	d := a.authorizeProtocols(context, uid, groups, path, pathAttrs)
+	if cacheable && d.err == nil {
+		cache.put(key, d)
+	}
+	return d
+}
+
+func (a *AAA) authorizeProtocols(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs) authzDecision {
+	if policy := a.getAuthzPolicy(); policy.Mode == RequireAll {
+		return a.authorizeAllProtocols(context, uid, groups, path, pathAttrs, policy)
+	}
+
+	var d authzDecision
+	var lastErr error
+	var decided bool
+	skipUnhealthy := a.getAuthzPolicy().SkipUnhealthy
+
+	for _, protocol := range a.OrderedProtocols() {
+		if !protocol.Cfg.CmdAuthor || !protocol.Cfg.appliesTo(context) {
+			continue
+		}
+		if err := protocol.skipIfUnhealthy(skipUnhealthy); err != nil {
+			lastErr = err
+			continue
+		}
+		valid, err := protocol.ValidUser(uid, groups)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !valid {
+			continue
+		}
+
+		d.source = protocol.Cfg.Name
+		authorized, reason, err := protocol.authorize(context, uid, groups, path, pathAttrs)
+		protocol.countAuthz(authorized, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		d.reason = reason
+		if authorized {
+			d.authorized = true
+			return d
+		}
+		decided = true
+	}
+
+	if !decided {
+		d.err = lastErr
+	}
+	return d
+}
+
+// HasAuthorizers reports whether any loaded protocol with command
+// authorization enabled applies to context, i.e. whether Authorize consults
+// any protocol for requests in that context. The context is normalized as for
+// Authorize.
+func (a *AAA) HasAuthorizers(context string) bool {
+	return a.hasAuthzProtocol(normalizeContext(context))
+}
+
+// As HasAuthorizers, for a normalized context
+func (a *AAA) hasAuthzProtocol(context string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, protocol := range a.Protocols {
+		if protocol.Cfg.CmdAuthor && protocol.Cfg.appliesTo(context) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AAA) defaultDecision() authzDecision {
+	return authzDecision{authorized: a.getAuthzPolicy().Default == AllowWhenNoProtocols}
+}
+
+// As authorizeProtocols, but requires every protocol consulted to authorize
+// path. The source of a denial is the protocol which denied it.
+func (a *AAA) authorizeAllProtocols(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs, policy AuthzPolicy) authzDecision {
+	var d authzDecision
+	var lastErr error
+	var decided bool
+
+	for _, protocol := range a.OrderedProtocols() {
+		if !protocol.Cfg.CmdAuthor || !protocol.Cfg.appliesTo(context) {
+			continue
+		}
+		valid := true
+		err := protocol.skipIfUnhealthy(policy.SkipUnhealthy)
+		if err == nil {
+			valid, err = protocol.ValidUser(uid, groups)
+		}
+		if err == nil && !valid {
+			continue
+		}
+
+		var authorized bool
+		var reason string
+		if err == nil {
+			authorized, reason, err = protocol.authorize(context, uid, groups,
+				path, pathAttrs)
+			protocol.countAuthz(authorized, err)
+		}
+		if err != nil && policy.SkipErrors {
+			lastErr = err
+			continue
+		}
+
+		d.source = protocol.Cfg.Name
+		d.reason = reason
+		if err != nil || !authorized {
+			return authzDecision{source: protocol.Cfg.Name, reason: reason}
+		}
+		decided = true
+	}
+
+	if decided {
+		d.authorized = true
+	} else {
+		d.err = lastErr
+	}
+	return d
+}
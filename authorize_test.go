@@ -0,0 +1,138 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Loads a protocol doing accounting but not authorization, which would
+// authorize everything, and one doing authorization but not accounting, which
+// authorizes nothing
+func loadMixedAAA(t *testing.T) (acct, author *mockPlugin, a *AAA) {
+	t.Helper()
+	acct, author = &mockPlugin{}, &mockPlugin{deny: true}
+	a = newMockAAA(t,
+		mockProtocol{"acct", AAAPluginConfig{CmdAcct: true, Priority: 1}, acct},
+		mockProtocol{"author", AAAPluginConfig{CmdAuthor: true, Priority: 2}, author},
+	)
+	return acct, author, a
+}
+
+func TestAuthorizeSkipsProtocolsWithoutCmdAuthor(t *testing.T) {
+	acct, _, a := loadMixedAAA(t)
+
+	authorized, source, err := a.AuthorizeWithSource("conf-mode", 1000, nil,
+		[]string{"show"}, nil)
+	if authorized || source != "author" || err != nil {
+		t.Errorf("Authorize() = %v, %q, %v, want denied by author",
+			authorized, source, err)
+	}
+	if got := acct.validUserCalls(); got != 0 {
+		t.Errorf("Protocol without command authorization consulted %d times", got)
+	}
+	if !a.HasAuthorizers("conf-mode") {
+		t.Error("HasAuthorizers() = false, want true")
+	}
+}
+
+func TestAuthorizeWithOnlyAccounting(t *testing.T) {
+	acct := &mockPlugin{}
+	a := newMockAAA(t, mockProtocol{"acct", AAAPluginConfig{CmdAcct: true}, acct})
+
+	tests := []struct {
+		policy DefaultDecision
+		want   bool
+	}{
+		{DenyWhenNoProtocols, false},
+		{AllowWhenNoProtocols, true},
+	}
+	for _, test := range tests {
+		a.SetAuthzPolicy(AuthzPolicy{Default: test.policy})
+		authorized, err := a.Authorize("conf-mode", 1000, nil, []string{"show"}, nil)
+		if authorized != test.want || err != nil {
+			t.Errorf("Authorize() with default %v = %v, %v, want %v, nil",
+				test.policy, authorized, err, test.want)
+		}
+	}
+	if got := acct.validUserCalls(); got != 0 {
+		t.Errorf("Protocol without command authorization consulted %d times", got)
+	}
+}
+
+func TestDefaultDecisionForContextWithoutAuthorizers(t *testing.T) {
+	plugin := &mockPlugin{deny: true}
+	cfg := AAAPluginConfig{CmdAuthor: true, Contexts: []string{"op-mode"}}
+	a := newMockAAA(t, mockProtocol{"mock", cfg, plugin})
+	a.SetAuthzPolicy(AuthzPolicy{Default: AllowWhenNoProtocols})
+
+	path := []string{"show"}
+	tests := map[string]func(aaaContext string) (bool, error){
+		"Authorize": func(aaaContext string) (bool, error) {
+			return a.Authorize(aaaContext, 1000, nil, path, nil)
+		},
+		"AuthorizeAny": func(aaaContext string) (bool, error) {
+			return a.AuthorizeAny(context.Background(), aaaContext, 1000, nil, path, nil)
+		},
+		"AuthorizeBatch": func(aaaContext string) (bool, error) {
+			authorized, err := a.AuthorizeBatch(aaaContext, 1000, nil, [][]string{path}, nil)
+			return len(authorized) == 1 && authorized[0], err
+		},
+	}
+	for name, authorize := range tests {
+		if authorized, err := authorize("conf-mode"); !authorized || err != nil {
+			t.Errorf("%s() in conf-mode = %v, %v, want the default decision",
+				name, authorized, err)
+		}
+		if authorized, err := authorize("op-mode"); authorized || err != nil {
+			t.Errorf("%s() in op-mode = %v, %v, want denied by mock",
+				name, authorized, err)
+		}
+	}
+}
+
+func TestSkipUnhealthyAuthorizers(t *testing.T) {
+	primary, fallback := &mockPlugin{}, &mockPlugin{deny: true}
+	a := newMockAAA(t,
+		mockProtocol{"primary", AAAPluginConfig{CmdAuthor: true, Priority: 1}, primary},
+		mockProtocol{"fallback", AAAPluginConfig{CmdAuthor: true, Priority: 2}, fallback},
+	)
+	primary.unhealthy = errors.New("server unreachable")
+	a.CheckHealth()
+
+	path := []string{"show"}
+	authorizers := map[string]func() (bool, error){
+		"Authorize": func() (bool, error) {
+			return a.Authorize("conf-mode", 1000, nil, path, nil)
+		},
+		"AuthorizeAny": func() (bool, error) {
+			return a.AuthorizeAny(context.Background(), "conf-mode", 1000, nil, path, nil)
+		},
+		"AuthorizeBatch": func() (bool, error) {
+			authorized, err := a.AuthorizeBatch("conf-mode", 1000, nil, [][]string{path}, nil)
+			return len(authorized) == 1 && authorized[0], err
+		},
+	}
+	for _, skip := range []bool{false, true} {
+		a.SetAuthzPolicy(AuthzPolicy{SkipUnhealthy: skip})
+		for name, authorize := range authorizers {
+			if authorized, err := authorize(); authorized == skip || err != nil {
+				t.Errorf("%s() with SkipUnhealthy %v = %v, %v, want %v, nil",
+					name, skip, authorized, err, !skip)
+			}
+		}
+	}
+
+	fallback.unhealthy = errors.New("server unreachable")
+	a.CheckHealth()
+	authorized, err := a.Authorize("conf-mode", 1000, nil, path, nil)
+	if authorized || !errors.Is(err, ErrProtocolUnhealthy) {
+		t.Errorf("Authorize() with every protocol unhealthy = %v, %v, want ErrProtocolUnhealthy",
+			authorized, err)
+	}
+}
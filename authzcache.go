@@ -0,0 +1,171 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"container/list"
+	"github.com/danos/utils/pathutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthzCacheOptions configures the cache of authorization decisions fronting
+// AAA.Authorize and its variants.
+type AuthzCacheOptions struct {
+	// Maximum number of decisions cached; zero disables the cache.
+	// The least recently used decision is evicted when the cache is full.
+	Size int
+	// Time for which a decision is cached; zero means until evicted or
+	// flushed.
+	TTL time.Duration
+	// Whether decisions for paths with elements marked secret are cached
+	CacheSecrets bool
+}
+
+type authzCacheEntry struct {
+	key      string
+	decision authzDecision
+	expires  time.Time
+}
+
+type authzCache struct {
+	opts    AuthzCacheOptions
+	mu      sync.Mutex
+	lru     *list.List // of *authzCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+func newAuthzCache(opts AuthzCacheOptions) *authzCache {
+	return &authzCache{
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func hasSecrets(pathAttrs *pathutil.PathAttrs) bool {
+	if pathAttrs == nil {
+		return false
+	}
+	for _, attr := range pathAttrs.Attrs {
+		if attr.Secret {
+			return true
+		}
+	}
+	return false
+}
+
+// Encodes each element with its length, so that distinct lists of strings
+// can not produce the same key.
+func writeKeyList(b *strings.Builder, elems []string) {
+	b.WriteString(strconv.Itoa(len(elems)))
+	for _, elem := range elems {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(len(elem)))
+		b.WriteByte(':')
+		b.WriteString(elem)
+	}
+	b.WriteByte(';')
+}
+
+// Returns the cache key of the request, and false if it must not be cached
+func (c *authzCache) key(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (string, bool) {
+	secret := hasSecrets(pathAttrs)
+	if secret && !c.opts.CacheSecrets {
+		return "", false
+	}
+
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	writeKeyList(&b, []string{context, strconv.FormatUint(uint64(uid), 10),
+		strconv.FormatBool(secret)})
+	writeKeyList(&b, sorted)
+	writeKeyList(&b, path)
+	return b.String(), true
+}
+
+func (c *authzCache) get(key string) (authzDecision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return authzDecision{}, false
+	}
+	entry := elem.Value.(*authzCacheEntry)
+	if c.opts.TTL > 0 && timeNow().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return authzDecision{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.decision, true
+}
+
+func (c *authzCache) put(key string, d authzDecision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &authzCacheEntry{key: key, decision: d}
+	if c.opts.TTL > 0 {
+		entry.expires = timeNow().Add(c.opts.TTL)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.opts.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*authzCacheEntry).key)
+	}
+}
+
+func (c *authzCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// SetAuthzCache configures caching of authorization decisions, replacing any
+// existing cache. Only decisions are cached, never errors. The cache is
+// flushed whenever protocols are reloaded.
+func (a *AAA) SetAuthzCache(opts AuthzCacheOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if opts.Size <= 0 {
+		a.authzCache = nil
+		return
+	}
+	a.authzCache = newAuthzCache(opts)
+}
+
+// FlushAuthzCache discards all cached authorization decisions.
+func (a *AAA) FlushAuthzCache() {
+	if c := a.getAuthzCache(); c != nil {
+		c.flush()
+	}
+}
+
+func (a *AAA) getAuthzCache() *authzCache {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.authzCache
+}
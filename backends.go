@@ -0,0 +1,46 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+// AAAPluginBackends may optionally be implemented by an AAAPlugin to report the
+// backend servers it is configured to use, e.g. the addresses of TACACS+
+// servers, for operational status output.
+type AAAPluginBackends interface {
+	// Returns the configured server endpoints, e.g. "192.0.2.1:49", in the
+	// order the plugin uses them
+	Backends() []string
+}
+
+// Returns the protocol's backend servers, or nil if its plugin does not
+// implement AAAPluginBackends or fails to report them
+func (p *AAAProtocol) backends() []string {
+	if !p.Capabilities().Backends {
+		return nil
+	}
+	b := unwrapAAAPlugin(p.Plugin).(AAAPluginBackends)
+
+	var backends []string
+	err := callPlugin(func() error {
+		backends = b.Backends()
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return append([]string(nil), backends...)
+}
+
+// Backends returns the backend servers of each loaded protocol whose plugin
+// reports them, keyed by protocol name, see AAAPluginBackends
+func (a *AAA) Backends() map[string][]string {
+	backends := make(map[string][]string)
+	for _, protocol := range a.OrderedProtocols() {
+		if b := protocol.backends(); b != nil {
+			backends[protocol.Cfg.Name] = b
+		}
+	}
+	return backends
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"fmt"
+	"github.com/danos/utils/pathutil"
+)
+
+// AAAPluginBatch may optionally be implemented by an AAAPlugin to authorize
+// many paths in one call, see AAA.AuthorizeBatch.
+type AAAPluginBatch interface {
+	// As for AAAPlugin.Authorize, for each of paths, whose attributes are
+	// given by the corresponding element of pathAttrs. Returns a decision for
+	// each path, in order; an error applies to all of them.
+	AuthorizeBatch(context string, uid uint32, groups []string, paths [][]string,
+		pathAttrs []*pathutil.PathAttrs) ([]bool, error)
+}
+
+// Authorizes all of paths, using AAAPluginBatch if supported by the plugin
+// (see Capabilities), otherwise path by path. Returns the decision, reason
+// and error for each path; reasons are empty when a batch is authorized.
+func (p *AAAProtocol) authorizeBatch(context string, uid uint32, groups []string,
+	paths [][]string, pathAttrs []*pathutil.PathAttrs) ([]bool, []string, []error) {
+	reasons := make([]string, len(paths))
+	errs := make([]error, len(paths))
+
+	if !p.Capabilities().Batch {
+		authorized := make([]bool, len(paths))
+		for i, path := range paths {
+			authorized[i], reasons[i], errs[i] = p.authorize(context, uid, groups,
+				path, pathAttrs[i])
+		}
+		return authorized, reasons, errs
+	}
+
+	var authorized []bool
+	err := callPlugin(func() error {
+		b := unwrapAAAPlugin(p.Plugin).(AAAPluginBatch)
+		var err error
+		authorized, err = b.AuthorizeBatch(context, uid, groups, paths, pathAttrs)
+		return err
+	})
+	if err == nil && len(authorized) != len(paths) {
+		err = fmt.Errorf("Plugin %s returned %d decisions for %d paths",
+			p.Cfg.Name, len(authorized), len(paths))
+	}
+	p.tracef("AuthorizeBatch(%q, %d, %q, %d paths) = %v, %v", context, uid, groups,
+		len(paths), authorized, err)
+	if err != nil {
+		authorized = make([]bool, len(paths))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return authorized, reasons, errs
+}
+
+// AuthorizeBatch authorizes each of paths as Authorize would, returning a
+// decision for each path in order. pathAttrs gives the attributes of the
+// corresponding path, and may be nil if none are known.
+//
+// The protocols to consult, and whether each is valid for the user, are
+// determined once for the whole batch, and the protocols whose plugins
+// implement AAAPluginBatch are passed every path they need to decide at once.
+// In RequireAll mode (see SetAuthzPolicy) each path is authorized in turn.
+//
+// If no protocol made a decision for some path because they all returned an
+// error, that path is not authorized, and the last such error is returned
+// along with the decisions for all paths.
+func (a *AAA) AuthorizeBatch(context string, uid uint32, groups []string,
+	paths [][]string, pathAttrs []*pathutil.PathAttrs) ([]bool, error) {
+	if pathAttrs == nil {
+		pathAttrs = make([]*pathutil.PathAttrs, len(paths))
+	}
+	if len(pathAttrs) != len(paths) {
+		return nil, fmt.Errorf("Got attributes for %d paths, expected %d",
+			len(pathAttrs), len(paths))
+	}
+
+	context = normalizeContext(context)
+	decisions := make([]authzDecision, len(paths))
+	switch {
+	case !a.hasAuthzProtocol(context):
+		for i := range decisions {
+			decisions[i] = a.defaultDecision()
+		}
+	case a.getAuthzPolicy().Mode == RequireAll:
+		for i, path := range paths {
+			decisions[i] = a.decide(context, uid, groups, path, pathAttrs[i])
+		}
+	default:
+		a.decideBatch(context, uid, groups, paths, pathAttrs, decisions)
+	}
+
+	authorized := make([]bool, len(paths))
+	var err error
+	for i, d := range decisions {
+		a.auditAuthz(context, uid, groups, paths[i], pathAttrs[i], d)
+		authorized[i] = d.authorized
+		if d.err != nil {
+			err = d.err
+		}
+	}
+	return authorized, err
+}
+
+// As decide, for every path, filling in decisions
+func (a *AAA) decideBatch(context string, uid uint32, groups []string,
+	paths [][]string, pathAttrs []*pathutil.PathAttrs, decisions []authzDecision) {
+	cache := a.getAuthzCache()
+	keys := make([]string, len(paths))
+	cacheable := make([]bool, len(paths))
+
+	var pending []int
+	for i, path := range paths {
+		if cache != nil {
+			keys[i], cacheable[i] = cache.key(context, uid, groups, path, pathAttrs[i])
+			if cacheable[i] {
+				if d, ok := cache.get(keys[i]); ok {
+					decisions[i] = d
+					continue
+				}
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+	if err := a.limitAuthz(uid); err != nil {
+		for _, i := range pending {
+			decisions[i] = authzDecision{err: err}
+		}
+		return
+	}
+	a.authorizeProtocolsBatch(context, uid, groups, paths, pathAttrs, pending, decisions)
+
+	for _, i := range pending {
+		if cacheable[i] && decisions[i].err == nil {
+			cache.put(keys[i], decisions[i])
+		}
+	}
+}
+
+// As authorizeProtocols in FirstAllow mode, for the paths whose indices are
+// listed in pending
+func (a *AAA) authorizeProtocolsBatch(context string, uid uint32, groups []string,
+	paths [][]string, pathAttrs []*pathutil.PathAttrs, pending []int,
+	decisions []authzDecision) {
+	lastErrs := make([]error, len(paths))
+	decided := make([]bool, len(paths))
+	undecided := pending
+	skipUnhealthy := a.getAuthzPolicy().SkipUnhealthy
+
+	for _, protocol := range a.OrderedProtocols() {
+		if len(pending) == 0 {
+			break
+		}
+		if !protocol.Cfg.CmdAuthor || !protocol.Cfg.appliesTo(context) {
+			continue
+		}
+		valid := true
+		err := protocol.skipIfUnhealthy(skipUnhealthy)
+		if err == nil {
+			valid, err = protocol.ValidUser(uid, groups)
+		}
+		if err != nil {
+			for _, i := range pending {
+				lastErrs[i] = err
+			}
+			continue
+		}
+		if !valid {
+			continue
+		}
+
+		batch := make([][]string, len(pending))
+		batchAttrs := make([]*pathutil.PathAttrs, len(pending))
+		for j, i := range pending {
+			batch[j], batchAttrs[j] = paths[i], pathAttrs[i]
+		}
+		authorized, reasons, errs := protocol.authorizeBatch(context, uid, groups,
+			batch, batchAttrs)
+
+		var remaining []int
+		for j, i := range pending {
+			decisions[i].source = protocol.Cfg.Name
+			protocol.countAuthz(authorized[j], errs[j])
+			if errs[j] != nil {
+				lastErrs[i] = errs[j]
+				remaining = append(remaining, i)
+				continue
+			}
+			decisions[i].reason = reasons[j]
+			if authorized[j] {
+				decisions[i].authorized = true
+				continue
+			}
+			decided[i] = true
+			remaining = append(remaining, i)
+		}
+		pending = remaining
+	}
+
+	for _, i := range undecided {
+		if !decisions[i].authorized && !decided[i] {
+			decisions[i].err = lastErrs[i]
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+// Capabilities describes which of the optional plugin features a protocol
+// supports. Each feature corresponds to an optional interface, or for
+// Authenticate to the AAAPlugin method of that name.
+type Capabilities struct {
+	Configure     bool // AAAPluginConfigurer
+	Teardown      bool // AAAPluginTeardown
+	Cancellation  bool // AAAPluginCtx
+	Reason        bool // AAAPluginReason
+	HealthCheck   bool // HealthChecker
+	EnvKeys       bool // AAAPluginEnvKeys
+	Authenticate  bool
+	AccountRecord bool // AAAPluginAccountRecord
+	Batch         bool // AAAPluginBatch
+	RequiredEnv   bool // AAAPluginRequiredEnv
+	Backends      bool // AAAPluginBackends
+	Ping          bool // AAAPluginPinger
+}
+
+// AAAPluginCapabilities may optionally be implemented by an AAAPlugin to
+// declare which optional features it supports.
+//
+// Features which are not declared are not used, even if the plugin implements
+// the corresponding interface. Declaring a feature whose interface is not
+// implemented has no effect. The capabilities of plugins which do not
+// implement AAAPluginCapabilities are detected from the interfaces they
+// implement.
+type AAAPluginCapabilities interface {
+	Capabilities() Capabilities
+}
+
+// Implemented by plugins of API version 3 and later
+type aaaPluginAuthenticator interface {
+	Authenticate(context string, user string, credentials map[string]string) (bool, error)
+}
+
+// Returns the capabilities implemented by impl
+func detectCapabilities(impl interface{}) Capabilities {
+	var caps Capabilities
+	_, caps.Configure = impl.(AAAPluginConfigurer)
+	_, caps.Teardown = impl.(AAAPluginTeardown)
+	_, caps.Cancellation = impl.(AAAPluginCtx)
+	_, caps.Reason = impl.(AAAPluginReason)
+	_, caps.HealthCheck = impl.(HealthChecker)
+	_, caps.EnvKeys = impl.(AAAPluginEnvKeys)
+	_, caps.Authenticate = impl.(aaaPluginAuthenticator)
+	_, caps.AccountRecord = impl.(AAAPluginAccountRecord)
+	_, caps.Batch = impl.(AAAPluginBatch)
+	_, caps.RequiredEnv = impl.(AAAPluginRequiredEnv)
+	_, caps.Backends = impl.(AAAPluginBackends)
+	_, caps.Ping = impl.(AAAPluginPinger)
+	return caps
+}
+
+func (c Capabilities) and(o Capabilities) Capabilities {
+	return Capabilities{
+		Configure:     c.Configure && o.Configure,
+		Teardown:      c.Teardown && o.Teardown,
+		Cancellation:  c.Cancellation && o.Cancellation,
+		Reason:        c.Reason && o.Reason,
+		HealthCheck:   c.HealthCheck && o.HealthCheck,
+		EnvKeys:       c.EnvKeys && o.EnvKeys,
+		Authenticate:  c.Authenticate && o.Authenticate,
+		AccountRecord: c.AccountRecord && o.AccountRecord,
+		Batch:         c.Batch && o.Batch,
+		RequiredEnv:   c.RequiredEnv && o.RequiredEnv,
+		Backends:      c.Backends && o.Backends,
+		Ping:          c.Ping && o.Ping,
+	}
+}
+
+// Capabilities returns the optional features supported by the protocol's
+// plugin, as described for AAAPluginCapabilities. They are determined once,
+// when the protocol is first set up or used.
+func (p *AAAProtocol) Capabilities() Capabilities {
+	p.capsOnce.Do(func() {
+		impl := unwrapAAAPlugin(p.Plugin)
+		p.caps = detectCapabilities(impl)
+
+		c, ok := impl.(AAAPluginCapabilities)
+		if !ok {
+			return
+		}
+		// A plugin which panics declaring its capabilities gets none
+		var declared Capabilities
+		callPlugin(func() error {
+			declared = c.Capabilities()
+			return nil
+		})
+		p.caps = p.caps.and(declared)
+	})
+	return p.caps
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CfgSymlinkDirs lists further directories in which the target of a plugin
+// config file which is a symlink may lie, e.g. a checkout of the configs. The
+// fully resolved target must lie within the plugin config directory or one of
+// these directories, otherwise the config fails to load. By default symlinked
+// configs may only point within the plugin config directory.
+var CfgSymlinkDirs []string
+
+// A plugin config directory on disk, remembering its path so that the targets
+// of symlinked config files can be checked
+type cfgDirFS struct {
+	fs.FS
+	dir string
+}
+
+func newCfgDirFS(dir string) fs.FS {
+	return cfgDirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// Reports whether a directory entry may be a plugin config file, i.e. is a
+// regular file or a symlink, which is checked by checkCfgFileTarget when read
+func isCfgFileEntry(file fs.DirEntry) bool {
+	return file.Type().IsRegular() || file.Type()&fs.ModeSymlink != 0
+}
+
+// Checks that the plugin config file name, following any symlinks, is a
+// regular file. For a config directory on disk the target of a symlink must
+// also lie within the permitted directories, see CfgSymlinkDirs. A symlink
+// loop fails to stat.
+func checkCfgFileTarget(cfgFS fs.FS, name string) error {
+	fi, err := fs.Stat(cfgFS, name)
+	if err != nil {
+		return fmt.Errorf("Failed to stat plugin config file: %s", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("Plugin config file %s is not a regular file", name)
+	}
+
+	if d, ok := cfgFS.(cfgDirFS); ok {
+		return d.checkLink(name)
+	}
+	return nil
+}
+
+func (d cfgDirFS) checkLink(name string) error {
+	link := filepath.Join(d.dir, name)
+	fi, err := os.Lstat(link)
+	if err != nil {
+		return fmt.Errorf("Failed to stat plugin config file: %s", err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve plugin config file %s: %s", name, err)
+	}
+	for _, dir := range append([]string{d.dir}, CfgSymlinkDirs...) {
+		if withinDir(dir, target) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Plugin config file %s links to %s, outside the permitted directories",
+		name, target)
+}
+
+// Reports whether path, which has had its symlinks resolved, lies within dir
+func withinDir(dir, path string) bool {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCfgSymlinkTargets(t *testing.T) {
+	cfgDir, otherDir := t.TempDir(), t.TempDir()
+	cfg := []byte(`{"name": "tacplus", "command-accounting": true}`)
+	for _, path := range []string{
+		filepath.Join(cfgDir, "configs", "tacplus.json"),
+		filepath.Join(otherDir, "tacplus.json"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, cfg, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inside.json":  filepath.Join(cfgDir, "configs", "tacplus.json"),
+		"outside.json": filepath.Join(otherDir, "tacplus.json"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(cfgDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		dirs    []string
+		wantErr bool
+	}{
+		{"inside.json", nil, false},
+		{"outside.json", nil, true},
+		{"outside.json", []string{otherDir}, false},
+	}
+	defer func(dirs []string) { CfgSymlinkDirs = dirs }(CfgSymlinkDirs)
+	for _, test := range tests {
+		CfgSymlinkDirs = test.dirs
+		err := checkCfgFileTarget(newCfgDirFS(cfgDir), test.name)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s with CfgSymlinkDirs %q: checkCfgFileTarget() = %v, want error: %v",
+				test.name, test.dirs, err, test.wantErr)
+		}
+	}
+}
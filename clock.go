@@ -0,0 +1,49 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Source of the current time for cache expiry, Watch debouncing and metrics
+// durations, so that tests can control time. Timers and timeouts, e.g.
+// RequestTimeout and SetupTimeout, always use real time.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+type clockHolder struct{ clock }
+
+var currentClock atomic.Value
+
+func init() {
+	currentClock.Store(clockHolder{realClock{}})
+}
+
+// Replaces the clock, returning the previous one. A nil clock selects real
+// time.
+func setClock(c clock) clock {
+	if c == nil {
+		c = realClock{}
+	}
+	prev := currentClock.Load().(clockHolder).clock
+	currentClock.Store(clockHolder{c})
+	return prev
+}
+
+func timeNow() time.Time {
+	return currentClock.Load().(clockHolder).Now()
+}
+
+func timeSince(t time.Time) time.Duration {
+	return timeNow().Sub(t)
+}
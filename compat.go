@@ -0,0 +1,132 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+	"plugin"
+)
+
+// Implemented by the adapters for older plugin API versions, to give access
+// to the underlying plugin implementation.
+type aaaPluginAdapter interface {
+	adapted() interface{}
+}
+
+// Returns the implementation underlying any plugin API version adapters, for
+// detection of the optional plugin interfaces.
+func unwrapAAAPlugin(p AAAPlugin) interface{} {
+	var impl interface{} = p
+	for {
+		a, ok := impl.(aaaPluginAdapter)
+		if !ok {
+			return impl
+		}
+		impl = a.adapted()
+	}
+}
+
+// AAAPluginV2 is the plugin interface of API version 2, which predates
+// authentication support. See AAAPlugin for a description of the methods.
+type AAAPluginV2 interface {
+	Setup() error
+
+	ValidUser(uid uint32, groups []string) (bool, error)
+
+	NewTask(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error)
+
+	Account(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs, env map[string]string) error
+
+	Authorize(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs) (bool, error)
+}
+
+// Adapts an AAAPluginV2 to the current AAAPlugin interface
+type aaaPluginV2Adapter struct {
+	AAAPluginV2
+}
+
+func adaptAAAPluginV2(sym plugin.Symbol) (AAAPlugin, bool) {
+	p, ok := sym.(AAAPluginV2)
+	if !ok {
+		return nil, false
+	}
+	return &aaaPluginV2Adapter{p}, true
+}
+
+func (p *aaaPluginV2Adapter) adapted() interface{} {
+	return p.AAAPluginV2
+}
+
+func (p *aaaPluginV2Adapter) Authenticate(string, string, map[string]string) (bool, error) {
+	return false, ErrAuthNotSupported
+}
+
+// AAAPluginV1 is the plugin interface of API version 1, which predates AAATask.
+// See AAAPlugin for a description of the methods.
+type AAAPluginV1 interface {
+	Setup() error
+
+	ValidUser(uid uint32, groups []string) (bool, error)
+
+	Account(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs, env map[string]string) error
+
+	Authorize(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs) (bool, error)
+}
+
+// Adapts an AAAPluginV1 to the AAAPluginV2 interface
+type aaaPluginV1Adapter struct {
+	AAAPluginV1
+}
+
+func adaptAAAPluginV1(sym plugin.Symbol) (AAAPlugin, bool) {
+	p, ok := sym.(AAAPluginV1)
+	if !ok {
+		return nil, false
+	}
+	return &aaaPluginV2Adapter{&aaaPluginV1Adapter{p}}, true
+}
+
+func (p *aaaPluginV1Adapter) adapted() interface{} {
+	return p.AAAPluginV1
+}
+
+// V1 plugins only support accounting a path as a single record, which is
+// made when the task is started.
+func (p *aaaPluginV1Adapter) NewTask(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	return &aaaTaskV1{
+		plugin:    p.AAAPluginV1,
+		context:   context,
+		uid:       uid,
+		groups:    groups,
+		path:      path,
+		pathAttrs: pathAttrs,
+		env:       env,
+	}, nil
+}
+
+type aaaTaskV1 struct {
+	plugin    AAAPluginV1
+	context   string
+	uid       uint32
+	groups    []string
+	path      []string
+	pathAttrs *pathutil.PathAttrs
+	env       map[string]string
+}
+
+func (t *aaaTaskV1) AccountStart() error {
+	return t.plugin.Account(t.context, t.uid, t.groups, t.path, t.pathAttrs, t.env)
+}
+
+func (t *aaaTaskV1) AccountStop(*error) error {
+	return nil
+}
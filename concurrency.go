@@ -0,0 +1,134 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"github.com/danos/utils/guard"
+	"sync"
+	"sync/atomic"
+)
+
+// Maximum number of calls into plugins which may run at once, across all
+// requests and protocols. Further calls queue until a running call completes.
+// Zero means no limit.
+var MaxConcurrentPluginCalls int
+
+var pluginCalls struct {
+	mu    sync.Mutex
+	sem   chan struct{}
+	limit int
+}
+
+// Number of plugin calls waiting for a slot
+var pluginCallsQueued int64
+
+// QueueMetricsSink may optionally be implemented by a MetricsSink to be told
+// the number of plugin calls waiting because MaxConcurrentPluginCalls calls
+// are already running, see QueuedPluginCalls.
+type QueueMetricsSink interface {
+	// Called with the new number whenever it changes. As the limit applies
+	// across all AAAs, the sink of every AAA is told. Calls are made in
+	// the order of the changes, so must not block.
+	ObserveQueuedPluginCalls(n int)
+}
+
+// The sinks told of changes to pluginCallsQueued, by the AAA they were set
+// on. Also held while changing pluginCallsQueued, so that the sinks see the
+// changes in order.
+var queueMetrics struct {
+	mu    sync.Mutex
+	sinks map[*AAA]QueueMetricsSink
+}
+
+// Tells sink of changes to the number of queued plugin calls if it implements
+// QueueMetricsSink, in place of any sink previously set on a
+func setQueueMetricsSink(a *AAA, sink MetricsSink) {
+	queueMetrics.mu.Lock()
+	defer queueMetrics.mu.Unlock()
+
+	q, ok := sink.(QueueMetricsSink)
+	if !ok {
+		delete(queueMetrics.sinks, a)
+		return
+	}
+	if queueMetrics.sinks == nil {
+		queueMetrics.sinks = make(map[*AAA]QueueMetricsSink)
+	}
+	queueMetrics.sinks[a] = q
+}
+
+func addQueuedPluginCalls(delta int64) {
+	queueMetrics.mu.Lock()
+	defer queueMetrics.mu.Unlock()
+
+	n := int(atomic.AddInt64(&pluginCallsQueued, delta))
+	for _, sink := range queueMetrics.sinks {
+		sink.ObserveQueuedPluginCalls(n)
+	}
+}
+
+// Returns the semaphore limiting plugin calls, or nil if there is no limit.
+// Calls already running when MaxConcurrentPluginCalls is changed complete
+// against the previous semaphore.
+func pluginCallSem() chan struct{} {
+	pluginCalls.mu.Lock()
+	defer pluginCalls.mu.Unlock()
+
+	if MaxConcurrentPluginCalls <= 0 {
+		return nil
+	}
+	if pluginCalls.limit != MaxConcurrentPluginCalls {
+		pluginCalls.sem = make(chan struct{}, MaxConcurrentPluginCalls)
+		pluginCalls.limit = MaxConcurrentPluginCalls
+	}
+	return pluginCalls.sem
+}
+
+// QueuedPluginCalls returns the number of plugin calls currently waiting
+// because MaxConcurrentPluginCalls calls are already running, e.g. for
+// reporting as a metric. See also QueueMetricsSink.
+func QueuedPluginCalls() int {
+	return int(atomic.LoadInt64(&pluginCallsQueued))
+}
+
+func waitPluginCall(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	addQueuedPluginCalls(1)
+	defer addQueuedPluginCalls(-1)
+
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Runs fn, which calls into a plugin, once permitted by
+// MaxConcurrentPluginCalls, converting any panic into an error. Every call
+// into plugin code goes through callPlugin or callPluginCtx. fn must not
+// itself wait for another call, e.g. by calling AAAProtocol.Capabilities, as
+// it could then wait for the slot it holds.
+func callPlugin(fn func() error) error {
+	return callPluginCtx(context.Background(), fn)
+}
+
+// As callPlugin, but gives up waiting to run fn once ctx is done
+func callPluginCtx(ctx context.Context, fn func() error) error {
+	if sem := pluginCallSem(); sem != nil {
+		if err := waitPluginCall(ctx, sem); err != nil {
+			return err
+		}
+		defer func() { <-sem }()
+	}
+	return guard.CatchPanicErrorOnly(fn)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Returned (wrapped) for plugin names which could resolve to a file outside
+// of the plugin directory
+var ErrUnsafePluginName = errors.New("Unsafe plugin name")
+
+// Returned (wrapped) by Validate for enabled configs with neither command
+// accounting nor command authorization enabled, as such a plugin would never be
+// used. The LoadAAA functions and Reload skip these configs, logging a
+// warning, rather than reporting an error, unless StrictLoad or StrictReload
+// respectively is set.
+var ErrPluginDoesNothing = errors.New(
+	"Plugin enables neither command accounting nor command authorization")
+
+// Contexts in which AAA requests are made
+const (
+	ContextOpMode   = "op-mode"
+	ContextConfMode = "conf-mode"
+)
+
+// Contexts which may be listed in AAAPluginConfig.Contexts
+var knownContexts = []string{ContextOpMode, ContextConfMode}
+
+// If set, NormalizeContext accepts unknown contexts, e.g. those of future
+// modes, rather than returning an error.
+var PermissiveContexts bool
+
+// Strips the characters which may vary between spellings of a context
+func contextKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(s)))
+}
+
+// NormalizeContext returns the canonical form of a context, e.g. "conf-mode"
+// for "Conf_Mode" or "confmode". An error is returned for unknown contexts
+// unless PermissiveContexts is set, in which case they are returned trimmed
+// and in lower case.
+func NormalizeContext(s string) (string, error) {
+	key := contextKey(s)
+	for _, context := range knownContexts {
+		if key == contextKey(context) {
+			return context, nil
+		}
+	}
+	if PermissiveContexts {
+		return strings.ToLower(strings.TrimSpace(s)), nil
+	}
+	return "", fmt.Errorf("Unknown context %q, expected one of: %s",
+		s, strings.Join(knownContexts, ", "))
+}
+
+// Returns the canonical form of a context passed to the AAA methods. Unknown
+// contexts are passed on unchanged, so that they still reach plugins and
+// protocols which apply to all contexts.
+func normalizeContext(s string) string {
+	if context, err := NormalizeContext(s); err == nil {
+		return context
+	}
+	return s
+}
+
+// Validate checks that the config is usable, returning a descriptive error
+// if not.
+func (c AAAPluginConfig) Validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("Plugin name must not be empty")
+	case strings.ContainsAny(c.Name, `/\`):
+		return fmt.Errorf("%w: %q must not contain path separators",
+			ErrUnsafePluginName, c.Name)
+	case c.Name == "." || c.Name == "..":
+		return fmt.Errorf("%w: %q is not a valid file name",
+			ErrUnsafePluginName, c.Name)
+	case strings.ContainsRune(c.Name, 0):
+		return fmt.Errorf("Plugin name %q must not contain NUL characters", c.Name)
+	case strings.ContainsAny(c.File, `/\`):
+		return fmt.Errorf("%w: file %q must not contain path separators",
+			ErrUnsafePluginName, c.File)
+	case c.File == "." || c.File == "..":
+		return fmt.Errorf("%w: file %q is not a valid file name",
+			ErrUnsafePluginName, c.File)
+	case strings.ContainsRune(c.File, 0):
+		return fmt.Errorf("Plugin file %q must not contain NUL characters", c.File)
+	case c.Symbol != "" && !isExportedIdent(c.Symbol):
+		return fmt.Errorf("Plugin symbol %q is not an exported Go identifier", c.Symbol)
+	}
+
+	for _, context := range c.Contexts {
+		if _, err := NormalizeContext(context); err != nil {
+			return err
+		}
+	}
+
+	if c.IsEnabled() && !c.CmdAcct && !c.CmdAuthor {
+		return fmt.Errorf("%w: %s", ErrPluginDoesNothing, c.Name)
+	}
+	return nil
+}
+
+func isExportedIdent(s string) bool {
+	for i, r := range s {
+		switch {
+		case i == 0 && !unicode.IsUpper(r):
+			return false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_':
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Reports whether a config which failed to read with err is to be skipped
+// because it enables nothing, logging a warning if so
+func skipDoingNothing(logger Logger, file string, err error, strict bool) bool {
+	if strict || !errors.Is(err, ErrPluginDoesNothing) {
+		return false
+	}
+	logger.Printf("Warning: %s: %v, skipping", file, err)
+	return true
+}
+
+// Reports whether the config applies to the given context, which must be
+// normalized
+func (c AAAPluginConfig) appliesTo(context string) bool {
+	if len(c.Contexts) == 0 {
+		return true
+	}
+	for _, elem := range c.Contexts {
+		if normalizeContext(elem) == context {
+			return true
+		}
+	}
+	return false
+}
+
+// Suffix appended to a plugin's name to give the name of its plugin file, e.g.
+// ".so.2" for versioned plugin files
+var PluginFileExt = ".so"
+
+// Returns the name of the plugin file, from which pluginPath resolves its path
+func (c AAAPluginConfig) pluginFile() string {
+	if c.File != "" {
+		return c.File
+	}
+	return c.Name
+}
+
+// Resolves the path of the named plugin, ensuring it lies within pluginDir.
+// PluginFileExt is not appended if name already ends with it.
+func pluginPath(pluginDir, name string) (string, error) {
+	if !strings.HasSuffix(name, PluginFileExt) {
+		name += PluginFileExt
+	}
+	dir := filepath.Clean(pluginDir)
+	path := filepath.Join(dir, name)
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("%w: %q resolves outside of %s",
+			ErrUnsafePluginName, name, dir)
+	}
+	return path, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPluginFile(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+		err  error
+	}{
+		{"", "tacplus.so", nil},
+		{"tacplus-radius", "tacplus-radius.so", nil},
+		{"tacplus-radius.so", "tacplus-radius.so", nil},
+		{"../tacplus", "", ErrUnsafePluginName},
+		{"..", "", ErrUnsafePluginName},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		cfg := AAAPluginConfig{Name: "tacplus", File: test.file, CmdAcct: true}
+		if err := cfg.Validate(); !errors.Is(err, test.err) {
+			t.Errorf("%q: Validate() = %v, want %v", test.file, err, test.err)
+		}
+		if test.err != nil {
+			continue
+		}
+		if path, err := pluginPath(dir, cfg.pluginFile()); err != nil ||
+			path != filepath.Join(dir, test.want) {
+			t.Errorf("%q: plugin path = %q, %v, want %s", test.file, path, err, test.want)
+		}
+	}
+}
+
+func TestDefaultsMayNotSetFile(t *testing.T) {
+	cfgFS := fstest.MapFS{
+		AAAPluginsDefaultsCfgFile: {Data: []byte(`{"file": "tacplus"}`)},
+	}
+	if _, err := readAAAPluginDefaults(cfgFS); err == nil {
+		t.Error("Defaults setting the plugin file were accepted")
+	}
+}
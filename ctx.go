@@ -0,0 +1,280 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"fmt"
+	"github.com/danos/utils/pathutil"
+	"time"
+)
+
+// Maximum number of protocols consulted concurrently by AuthorizeAny
+var MaxAuthorizeAnyConcurrency = 4
+
+// Deadline applied to each request made through the context-aware AAAProtocol
+// methods, on top of any deadline already carried by the caller's context,
+// unless overridden by the protocol's config. Zero means no additional
+// deadline is applied.
+var RequestTimeout time.Duration
+
+// AAAPluginCtx may optionally be implemented by an AAAPlugin to support
+// cancellation of requests. See AAAPlugin for a description of the parameters.
+//
+// Plugins should abandon the request and return ctx.Err() once ctx is done.
+type AAAPluginCtx interface {
+	AuthorizeCtx(ctx context.Context, context string, uid uint32, groups []string,
+		path []string, pathAttrs *pathutil.PathAttrs) (bool, error)
+
+	NewTaskCtx(ctx context.Context, context string, uid uint32, groups []string,
+		path []string, pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the given correlation ID, which
+// ties AAA operations made with the context-aware methods to the request
+// being served. Tasks instantiated by NewTaskCtx receive it as EnvRequestID,
+// and plugins implementing AAAPluginCtx may retrieve it with RequestID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the correlation ID carried by ctx, if any
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// Describes the correlation ID id for log lines, e.g. " (request 1234)", or
+// returns "" if id is empty
+func logRequestID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (request %s)", id)
+}
+
+// Returns env with EnvRequestID set from ctx, unless already set. env itself
+// is not modified.
+func withRequestIDEnv(ctx context.Context, env map[string]string) map[string]string {
+	id, ok := RequestID(ctx)
+	if !ok {
+		return env
+	}
+	if _, ok := env[EnvRequestID]; ok {
+		return env
+	}
+
+	withID := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		withID[k] = v
+	}
+	withID[EnvRequestID] = id
+	return withID
+}
+
+// Returns the given per-protocol timeout, falling back to RequestTimeout
+func requestTimeout(timeoutMs int) time.Duration {
+	if timeoutMs > 0 {
+		return time.Duration(timeoutMs) * time.Millisecond
+	}
+	return RequestTimeout
+}
+
+// Applies the given per-protocol timeout, falling back to RequestTimeout
+func withRequestTimeout(ctx context.Context, timeoutMs int) (context.Context, context.CancelFunc) {
+	if timeout := requestTimeout(timeoutMs); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// AuthorizeCtx authorizes path using the protocol's plugin, giving up once ctx
+// is done or the protocol's authorize timeout (see
+// AAAPluginConfig.AuthorizeTimeoutMs) expires.
+//
+// If the plugin does not implement AAAPluginCtx its Authorize method is used
+// instead. It can not be interrupted, but the result is abandoned and
+// ctx.Err() is returned if it does not complete in time.
+func (p *AAAProtocol) AuthorizeCtx(ctx context.Context, aaaContext string,
+	uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (bool, error) {
+	ctx, cancel := withRequestTimeout(ctx, p.Cfg.AuthorizeTimeoutMs)
+	defer cancel()
+
+	if p.Capabilities().Cancellation {
+		c := unwrapAAAPlugin(p.Plugin).(AAAPluginCtx)
+		return p.authorizeCtx(c, ctx, aaaContext, uid, groups, path, pathAttrs)
+	}
+
+	type result struct {
+		authorized bool
+		err        error
+	}
+	ch := make(chan result, 1)
+	requestID, _ := RequestID(ctx)
+	go func() {
+		authorized, _, err := p.authorizeRequest(requestID, aaaContext, uid, groups,
+			path, pathAttrs)
+		ch <- result{authorized, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.authorized, r.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// NewTaskCtx instantiates a task using the protocol's plugin, giving up once
+// ctx is done or the protocol's accounting timeout (see
+// AAAPluginConfig.AcctTimeoutMs) expires.
+//
+// If the plugin does not implement AAAPluginCtx its NewTask method is used
+// instead, with the same caveats as for AuthorizeCtx.
+//
+// The accounting timeout also bounds each AccountStart, AccountStop and
+// AccountUpdate call on the returned task, including through the package's
+// task wrappers. A call which does not complete in time is abandoned and
+// returns context.DeadlineExceeded.
+//
+// Any correlation ID carried by ctx (see WithRequestID) is passed to the
+// plugin as EnvRequestID, unless env already sets it.
+func (p *AAAProtocol) NewTaskCtx(ctx context.Context, aaaContext string,
+	uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	ctx, cancel := withRequestTimeout(ctx, p.Cfg.AcctTimeoutMs)
+	defer cancel()
+
+	env = withRequestIDEnv(ctx, env)
+
+	if p.Capabilities().Cancellation {
+		c := unwrapAAAPlugin(p.Plugin).(AAAPluginCtx)
+		task, err := p.newTaskCtx(c, ctx, aaaContext, uid, groups, path, pathAttrs, env)
+		return p.withAcctTimeout(task), err
+	}
+
+	type result struct {
+		task AAATask
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		task, err := p.newTask(aaaContext, uid, groups, path, pathAttrs, env)
+		ch <- result{task, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return p.withAcctTimeout(r.task), r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Bounds the accounting calls of task, as returned by newTask or newTaskCtx,
+// by the protocol's accounting timeout
+func (p *AAAProtocol) withAcctTimeout(task AAATask) AAATask {
+	if g, ok := task.(guardedTask); ok {
+		g.timeout = requestTimeout(p.Cfg.AcctTimeoutMs)
+		return g
+	}
+	return task
+}
+
+// AuthorizeAny consults all protocols which Authorize would consult
+// concurrently, returning true as soon as any of them authorizes path. The
+// remaining requests are then cancelled.
+//
+// At most MaxAuthorizeAnyConcurrency protocols are consulted at once, and
+// each request honours ctx and the protocol's timeout as described for
+// AAAProtocol.AuthorizeCtx. False is returned if no protocol authorizes path;
+// if no protocol made a decision because they all failed, their errors are
+// returned.
+func (a *AAA) AuthorizeAny(ctx context.Context, aaaContext string, uid uint32,
+	groups []string, path []string, pathAttrs *pathutil.PathAttrs) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	aaaContext = normalizeContext(aaaContext)
+	if !a.hasAuthzProtocol(aaaContext) {
+		return a.defaultDecision().authorized, nil
+	}
+	if err := a.limitAuthzCtx(ctx, uid); err != nil {
+		return false, err
+	}
+
+	var protocols []*AAAProtocol
+	for _, protocol := range a.OrderedProtocols() {
+		if protocol.Cfg.CmdAuthor && protocol.Cfg.appliesTo(aaaContext) {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	type result struct {
+		decided    bool
+		authorized bool
+		err        error
+	}
+	results := make(chan result, len(protocols))
+
+	limit := MaxAuthorizeAnyConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	skipUnhealthy := a.getAuthzPolicy().SkipUnhealthy
+
+	for _, protocol := range protocols {
+		go func(protocol *AAAProtocol) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results <- result{err: ctx.Err()}
+				return
+			}
+
+			if err := protocol.skipIfUnhealthy(skipUnhealthy); err != nil {
+				results <- result{err: err}
+				return
+			}
+			valid, err := protocol.ValidUser(uid, groups)
+			if err != nil || !valid {
+				results <- result{err: err}
+				return
+			}
+			authorized, err := protocol.AuthorizeCtx(ctx, aaaContext, uid, groups,
+				path, pathAttrs)
+			protocol.countAuthz(authorized, err)
+			results <- result{decided: err == nil, authorized: authorized, err: err}
+		}(protocol)
+	}
+
+	var errs errorList
+	var decided bool
+	for range protocols {
+		select {
+		case r := <-results:
+			if r.authorized {
+				return true, nil
+			}
+			decided = decided || r.decided
+			if r.err != nil {
+				errs = append(errs, r.err)
+			}
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	if decided || len(errs) == 0 {
+		return false, nil
+	}
+	return false, errs
+}
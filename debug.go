@@ -0,0 +1,73 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"sort"
+	"strings"
+)
+
+type traceLogger struct{ Logger }
+
+// SetDebug enables or disables tracing of every call into the plugins of the
+// loaded protocols, and of those loaded later by Reload, ReloadProtocol and
+// AddProtocol. Each call to ValidUser, Authorize, Authenticate, NewTask and
+// the accounting methods of tasks is logged to a's Logger along with its
+// result.
+//
+// Secret path elements are redacted as by RedactPath, the values of sensitive
+// env keys as by DescribeTask, and only the keys of Authenticate's credentials
+// are logged. Calls made for a request with a correlation ID (see
+// WithRequestID) are logged with it. Plugin settings are never logged.
+func (a *AAA) SetDebug(enabled bool) {
+	a.mu.Lock()
+	a.debug = enabled
+	a.mu.Unlock()
+
+	a.applyDebug()
+}
+
+// Applies the debug setting to each loaded protocol
+func (a *AAA) applyDebug() {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var logger Logger
+	if a.debug {
+		logger = a.log()
+	}
+	for _, protocol := range a.Protocols {
+		protocol.trace.Store(traceLogger{logger})
+	}
+}
+
+func (p *AAAProtocol) tracing() bool {
+	t, ok := p.trace.Load().(traceLogger)
+	return ok && t.Logger != nil
+}
+
+func (p *AAAProtocol) tracef(format string, args ...interface{}) {
+	p.tracefRequest("", format, args...)
+}
+
+// As tracef, for a call made for the request with the given correlation ID,
+// if any
+func (p *AAAProtocol) tracefRequest(requestID string, format string, args ...interface{}) {
+	if t, ok := p.trace.Load().(traceLogger); ok && t.Logger != nil {
+		t.Printf("AAA %s%s: "+format,
+			append([]interface{}{p.Cfg.Name, logRequestID(requestID)}, args...)...)
+	}
+}
+
+// Returns the sorted keys of m, for logging credentials without their values
+func mapKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return "[" + strings.Join(keys, " ") + "]"
+}
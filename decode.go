@@ -0,0 +1,67 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// If set, plugin config files containing fields other than those of
+// AAAPluginConfig fail to load, catching typos such as "comand-accounting".
+// Plugin specific settings belong in the "settings" field, which is not
+// checked.
+var StrictConfigFields bool
+
+// Maximum size in bytes of a plugin config file, including the merged config
+// file. Larger files fail to load. Zero means no limit.
+var MaxCfgFileSize int64 = 1 << 20
+
+// Returned (wrapped) for plugin config files larger than MaxCfgFileSize
+var ErrCfgFileTooLarge = errors.New("Plugin config file too large")
+
+// Returns a decoder of plugin configs from r, rejecting unknown fields if
+// StrictConfigFields is set
+func newCfgDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	if StrictConfigFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec
+}
+
+// Returns a reader of r which fails with ErrCfgFileTooLarge once more than
+// MaxCfgFileSize bytes have been read
+func limitCfgFile(r io.Reader) io.Reader {
+	if MaxCfgFileSize <= 0 {
+		return r
+	}
+	return &cfgFileLimiter{r: r, max: MaxCfgFileSize, left: MaxCfgFileSize}
+}
+
+type cfgFileLimiter struct {
+	r         io.Reader
+	max, left int64
+}
+
+func (l *cfgFileLimiter) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell a file of exactly the maximum
+	// size from a larger one, but do not return it, so that the decoder
+	// never sees a truncated file as complete
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.left {
+		n = int(l.left)
+		l.left = 0
+		return n, fmt.Errorf("%w, exceeding %d bytes", ErrCfgFileTooLarge, l.max)
+	}
+	l.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build go1.18
+// +build go1.18
+
+package aaa
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func FuzzDecodeConfig(f *testing.F) {
+	for _, seed := range []string{
+		`{"name": "tacplus", "command-accounting": true}`,
+		`{"name": "radius", "command-authorization": true, "priority": 10,
+			"contexts": ["conf-mode"], "settings": {"servers": [{"secret": "s"}]}}`,
+		`{"name": "x", "comand-accounting": true}`,
+		`{"name": "../x", "command-accounting": true}`,
+		`[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[[`,
+		`{"settings": ` + string(bytes.Repeat([]byte("["), 1000)),
+		``,
+	} {
+		f.Add([]byte(seed), false)
+		f.Add([]byte(seed), true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, strict bool) {
+		defer func(prev bool) { StrictConfigFields = prev }(StrictConfigFields)
+		StrictConfigFields = strict
+
+		cfg, err := decodeAAAPluginConfig(limitCfgFile(bytes.NewReader(data)),
+			AAAPluginConfig{Priority: DefaultPriority})
+		if int64(len(data)) > MaxCfgFileSize && !errors.Is(err, ErrCfgFileTooLarge) {
+			t.Fatalf("Config of %d bytes decoded with %v", len(data), err)
+		}
+		if err != nil {
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Decoded config is not valid: %v", err)
+		}
+		if _, err := pluginPath(t.TempDir(), cfg.pluginFile()); err != nil {
+			t.Fatalf("Decoded config names an unsafe plugin: %v", err)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Name of an optional file in the plugin config directory holding a JSON
+// object with AAAPluginConfig fields which apply to every plugin config, e.g.
+// {"command-accounting": true}. It is not itself a plugin config.
+//
+// Each plugin config, including each entry of the merged config file, is
+// decoded over the defaults, so a field set by the plugin config takes
+// precedence even if set to false or empty. Lists and settings are replaced
+// rather than merged. The defaults may not set the name, sha256, symbol or
+// file fields, which are specific to a plugin. The resulting config is
+// validated as usual.
+const AAAPluginsDefaultsCfgFile = "defaults.json"
+
+// Reads the config defaults, which are those of an empty config if there is
+// no defaults file. They are read afresh for each plugin config, as decoding
+// a config over them may reuse their lists.
+func readAAAPluginDefaults(cfgFS fs.FS) (AAAPluginConfig, error) {
+	cfg := AAAPluginConfig{Priority: DefaultPriority}
+	if _, err := fs.Stat(cfgFS, AAAPluginsDefaultsCfgFile); errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err := checkCfgFileTarget(cfgFS, AAAPluginsDefaultsCfgFile); err != nil {
+		return cfg, err
+	}
+
+	f, e := cfgFS.Open(AAAPluginsDefaultsCfgFile)
+	if e != nil {
+		err := fmt.Errorf("Failed opening plugin config defaults file: %s", e)
+		return cfg, err
+	}
+	defer f.Close()
+
+	if e := newCfgDecoder(limitCfgFile(f)).Decode(&cfg); e != nil {
+		err := fmt.Errorf("Failed to decode plugin config defaults file: %w", e)
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	if cfg.Name != "" || cfg.Sha256 != "" || cfg.Symbol != "" || cfg.File != "" {
+		err := fmt.Errorf("Plugin config defaults file may not set name, sha256, symbol or file")
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	return cfg, nil
+}
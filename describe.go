@@ -0,0 +1,134 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/danos/utils/pathutil"
+	"strings"
+)
+
+// Replaces sensitive values in descriptions and logs
+const redacted = "***"
+
+// Substrings identifying env keys whose values must not be disclosed
+var sensitiveKeyParts = []string{"password", "secret", "key", "token", "credential"}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of env with the values of sensitive keys replaced
+func redactEnv(env map[string]string) map[string]string {
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		if isSensitiveKey(k) {
+			v = redacted
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Returns v, decoded from JSON, with the values of sensitive keys of any
+// objects within it replaced
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if isSensitiveKey(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(elem)
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redactJSON(elem)
+		}
+	}
+	return v
+}
+
+// Redacted returns a copy of the config which is safe to disclose, e.g. in
+// diagnostics. The values of settings whose names look sensitive (e.g.
+// "secret" or "key"), within nested objects too, are replaced with "***".
+// Settings which are not valid JSON are replaced entirely.
+func (c AAAPluginConfig) Redacted() AAAPluginConfig {
+	if len(c.Settings) == 0 {
+		return c
+	}
+
+	var settings interface{}
+	dec := json.NewDecoder(bytes.NewReader(c.Settings))
+	dec.UseNumber()
+	if err := dec.Decode(&settings); err != nil {
+		c.Settings = json.RawMessage(`"` + redacted + `"`)
+		return c
+	}
+
+	b, err := json.Marshal(redactJSON(settings))
+	if err != nil {
+		b = []byte(`"` + redacted + `"`)
+	}
+	c.Settings = b
+	return c
+}
+
+// Replaces path elements marked secret, see RedactPath
+const RedactedPathElem = "**"
+
+// RedactPath returns a copy of path with the elements marked secret in attrs
+// replaced with RedactedPathElem, for use before logging or recording path.
+// A nil attrs marks no element secret, as do attrs which are missing for
+// some elements.
+func RedactPath(path []string, attrs *pathutil.PathAttrs) []string {
+	out := make([]string, len(path))
+	for i, elem := range path {
+		if attrs != nil && i < len(attrs.Attrs) && attrs.Attrs[i].Secret {
+			elem = RedactedPathElem
+		}
+		out[i] = elem
+	}
+	return out
+}
+
+type taskDescription struct {
+	Context string            `json:"context"`
+	UID     uint32            `json:"uid"`
+	Groups  []string          `json:"groups"`
+	Path    []string          `json:"path"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// DescribeTask returns a compact JSON description of the given task
+// parameters, for logging. Path elements marked secret in attrs, and the
+// values of env keys which look sensitive (e.g. "password"), are redacted.
+func DescribeTask(context string, uid uint32, groups []string, path []string,
+	attrs *pathutil.PathAttrs, env map[string]string) string {
+	desc := taskDescription{
+		Context: context,
+		UID:     uid,
+		Groups:  groups,
+		Path:    RedactPath(path, attrs),
+	}
+	if len(env) > 0 {
+		desc.Env = redactEnv(env)
+	}
+
+	b, err := json.Marshal(desc)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
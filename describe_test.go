@@ -0,0 +1,52 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactedSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     string
+	}{
+		{"none", ``, ``},
+		{"flat",
+			`{"server": "10.0.0.1", "secret": "s3cret", "timeout": 5}`,
+			`{"secret":"***","server":"10.0.0.1","timeout":5}`},
+		{"nested",
+			`{"servers": {"primary": {"address": "10.0.0.1", "shared-key": "k1"}}}`,
+			`{"servers":{"primary":{"address":"10.0.0.1","shared-key":"***"}}}`},
+		{"in lists",
+			`{"servers": [{"address": "10.0.0.1", "Password": "p1"}, {"address": "10.0.0.2"}]}`,
+			`{"servers":[{"Password":"***","address":"10.0.0.1"},{"address":"10.0.0.2"}]}`},
+		{"sensitive object",
+			`{"credentials": {"user": "admin", "token": "t1"}}`,
+			`{"credentials":"***"}`},
+		{"large number", `{"port": 12345678901234567890}`, `{"port":12345678901234567890}`},
+		{"invalid", `{"secret": `, `"***"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := AAAPluginConfig{Name: "radius", Settings: json.RawMessage(test.settings)}
+			got := cfg.Redacted()
+			if string(got.Settings) != test.want {
+				t.Errorf("Redacted().Settings = %s, want %s", got.Settings, test.want)
+			}
+			if !bytes.Equal(cfg.Settings, []byte(test.settings)) {
+				t.Errorf("Redacted() modified the config's settings: %s", cfg.Settings)
+			}
+			if got.Name != cfg.Name {
+				t.Errorf("Redacted().Name = %q, want %q", got.Name, cfg.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigChange describes how the config of a protocol differs between two sets
+// of configs, see DiffConfigs
+type ConfigChange struct {
+	Name string
+	// ChangeAdded, ChangeRemoved, or ChangeReloaded for a protocol whose
+	// config is modified, as Reload would report the change
+	Kind ChangeKind
+	// The fields which differ, for ChangeReloaded, in the order of
+	// AAAPluginConfig
+	Fields []FieldChange
+}
+
+// FieldChange describes a field of a plugin config which differs between two
+// configs
+type FieldChange struct {
+	// JSON name of the field, e.g. "priority"
+	Field string
+	// JSON encoded values, with secret settings redacted as for
+	// AAAPluginConfig.Redacted
+	Old string
+	New string
+}
+
+// String describes the change, e.g. "radius: priority 10 -> 20"
+func (c ConfigChange) String() string {
+	if c.Kind != ChangeReloaded {
+		return fmt.Sprintf("%s: %s", c.Name, strings.ToLower(c.Kind.String()))
+	}
+	fields := make([]string, 0, len(c.Fields))
+	for _, f := range c.Fields {
+		fields = append(fields, fmt.Sprintf("%s %s -> %s", f.Field, f.Old, f.New))
+	}
+	return fmt.Sprintf("%s: %s", c.Name, strings.Join(fields, ", "))
+}
+
+// DiffConfigs returns the changes to the protocols which replacing the configs
+// oldCfg with newCfg would make, in order of name, e.g. for previewing a
+// reload. Configs which disable their plugin are treated as absent, so
+// disabling a protocol removes it.
+//
+// Configs are compared as they are loaded, ignoring differences with no
+// effect: the order of the keys of the settings, the spelling and order of
+// the contexts, and an unset enabled field. Changes to secret settings are
+// reported, but with redacted values.
+func DiffConfigs(oldCfg, newCfg []AAAPluginConfig) []ConfigChange {
+	oldByName := enabledConfigsByName(oldCfg)
+	newByName := enabledConfigsByName(newCfg)
+
+	var changes []ConfigChange
+	for name := range oldByName {
+		if _, ok := newByName[name]; !ok {
+			changes = append(changes, ConfigChange{Name: name, Kind: ChangeRemoved})
+		}
+	}
+	for name, n := range newByName {
+		o, ok := oldByName[name]
+		if !ok {
+			changes = append(changes, ConfigChange{Name: name, Kind: ChangeAdded})
+			continue
+		}
+		if fields := diffConfigFields(o, n); len(fields) > 0 {
+			changes = append(changes, ConfigChange{
+				Name:   name,
+				Kind:   ChangeReloaded,
+				Fields: fields,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Returns the enabled configs by name. The first of several configs with the
+// same name is used, as by the LoadAAA functions.
+func enabledConfigsByName(cfgs []AAAPluginConfig) map[string]AAAPluginConfig {
+	byName := make(map[string]AAAPluginConfig, len(cfgs))
+	for _, cfg := range cfgs {
+		if _, ok := byName[cfg.Name]; ok || !cfg.IsEnabled() {
+			continue
+		}
+		byName[cfg.Name] = cfg
+	}
+	return byName
+}
+
+func diffConfigFields(o, n AAAPluginConfig) []FieldChange {
+	oldFields, newFields := configFields(o), configFields(n)
+	oldShown, newShown := configFields(o.Redacted()), configFields(n.Redacted())
+
+	var changes []FieldChange
+	t := reflect.TypeOf(AAAPluginConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		field := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if reflect.DeepEqual(oldFields[field], newFields[field]) {
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Field: field,
+			Old:   encodeField(oldShown[field]),
+			New:   encodeField(newShown[field]),
+		})
+	}
+	return changes
+}
+
+// Returns the fields of cfg, as loaded, decoded from JSON so that settings
+// compare equal regardless of the order of their keys
+func configFields(cfg AAAPluginConfig) map[string]interface{} {
+	enabled := cfg.IsEnabled()
+	cfg.Enabled = &enabled
+	contexts := make([]string, 0, len(cfg.Contexts))
+	for _, context := range cfg.Contexts {
+		contexts = append(contexts, normalizeContext(context))
+	}
+	sort.Strings(contexts)
+	cfg.Contexts = contexts
+
+	settings := cfg.Settings
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		// Invalid settings, compared as they are
+		cfg.Settings = nil
+		b, _ = json.Marshal(cfg)
+	}
+
+	fields := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	dec.Decode(&fields)
+	if err != nil {
+		fields["settings"] = string(settings)
+	}
+	return fields
+}
+
+func encodeField(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Returned when creating a task once Drain has been called
+var ErrDraining = errors.New("AAA is draining, no new tasks may be created")
+
+// Tracks the tasks created by the AAA helpers (NewTimedTask, NewRetryingTask
+// and RunAccounted) until their accounting is stopped
+type taskTracker struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight int
+	idle     chan struct{} // Closed once draining with no tasks in flight
+}
+
+func (t *taskTracker) start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return ErrDraining
+	}
+	t.inFlight++
+	return nil
+}
+
+func (t *taskTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight--
+	if t.draining && t.inFlight == 0 {
+		close(t.idle)
+	}
+}
+
+// Stops new tasks from starting, returning a channel closed once no tasks
+// are in flight
+func (t *taskTracker) drain() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.draining {
+		t.draining = true
+		t.idle = make(chan struct{})
+		if t.inFlight == 0 {
+			close(t.idle)
+		}
+	}
+	return t.idle
+}
+
+// Wraps task, identified by id, so that it is tracked until its accounting is
+// stopped
+func (t *taskTracker) track(task AAATask, id string) AAATask {
+	return &trackedTask{task: task, tracker: t, id: id}
+}
+
+type trackedTask struct {
+	task    AAATask
+	tracker *taskTracker
+	once    sync.Once
+	id      string
+}
+
+func (t *trackedTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t *trackedTask) TaskID() string {
+	return t.id
+}
+
+func (t *trackedTask) AccountStart() error {
+	return t.task.AccountStart()
+}
+
+func (t *trackedTask) AccountStop(err *error) error {
+	defer t.once.Do(t.tracker.done)
+	return t.task.AccountStop(err)
+}
+
+func (t *trackedTask) AccountStopResult(result TaskResult) error {
+	defer t.once.Do(t.tracker.done)
+	return AccountStopWithResult(t.task, result)
+}
+
+// Drain prepares a for shutdown. New tasks can no longer be created by
+// NewTimedTask, NewRetryingTask and RunAccounted, which return ErrDraining,
+// and records passed to AccountAsync are dropped. Drain then waits for the
+// accounting of the tasks they created earlier to be stopped and for the
+// records queued by AccountAsync to be accounted, or for ctx to be done,
+// before tearing down every protocol (see AAAPluginTeardown).
+//
+// If ctx is done first its error is returned, once the protocols have been
+// torn down. The protocols can not be used after Drain returns.
+func (a *AAA) Drain(ctx context.Context) error {
+	var err error
+	select {
+	case <-a.tasks.drain():
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if e := a.drainAsync(ctx); err == nil {
+		err = e
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.teardown()
+	setQueueMetricsSink(a, nil)
+	return err
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build aaa_e2e
+// +build aaa_e2e
+
+// Package e2e tests loading a real plugin end to end. Its test is only built
+// with the aaa_e2e build tag as it compiles the fixture plugin in
+// testdata/plugin. The plugin is built without -race, so the test must be
+// too. It is kept out of package aaa so that the test and the plugin link the
+// same build of the package, without its test files.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"github.com/danos/aaa"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Directory holding the fixture plugin, built once as a plugin can only be
+// loaded from one file per process
+var pluginDir string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	var err error
+	pluginDir, err = ioutil.TempDir("", "aaa-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(pluginDir)
+
+	build := exec.Command("go", "build", "-buildmode=plugin",
+		"-o", filepath.Join(pluginDir, "e2e"+aaa.PluginFileExt), "./testdata/plugin")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build fixture plugin: %v\n%s", err, out)
+		return 1
+	}
+	return m.Run()
+}
+
+// Loads the fixture plugin as configured by the given config files, by name
+func loadAAA(t *testing.T, cfgs map[string]string) (*aaa.AAA, string) {
+	t.Helper()
+	cfgDir := t.TempDir()
+	for name, cfg := range cfgs {
+		if err := os.WriteFile(filepath.Join(cfgDir, name), []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for env, dir := range map[string]string{
+		aaa.EnvAAAPluginsCfgDir: cfgDir,
+		aaa.EnvAAAPluginsDir:    pluginDir,
+	} {
+		prev, ok := os.LookupEnv(env)
+		os.Setenv(env, dir)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(env, prev)
+			} else {
+				os.Unsetenv(env)
+			}
+		})
+	}
+
+	a, err := aaa.LoadAAA()
+	if err != nil {
+		t.Fatalf("LoadAAA() = %v", err)
+	}
+	t.Cleanup(func() { a.Drain(context.Background()) })
+	return a, cfgDir
+}
+
+func TestLoadPluginEndToEnd(t *testing.T) {
+	a, _ := loadAAA(t, map[string]string{
+		"e2e.json": `{"name": "e2e", "command-accounting": true, "command-authorization": true}`,
+	})
+
+	protocol, ok := a.Protocol("e2e")
+	if !ok {
+		t.Fatalf("Plugin not loaded, protocols: %v", a.ProtocolNames())
+	}
+	if protocol.APIVersion != aaa.AAAPluginAPIVersion {
+		t.Errorf("APIVersion = %d, want %d", protocol.APIVersion, aaa.AAAPluginAPIVersion)
+	}
+
+	// The plugin is only valid for users once set up
+	for uid, want := range map[uint32]bool{0: false, 1000: true} {
+		if valid, err := protocol.ValidUser(uid, nil); valid != want || err != nil {
+			t.Errorf("ValidUser(%d) = %v, %v, want %v, nil", uid, valid, err, want)
+		}
+	}
+	authorized, err := a.Authorize("conf-mode", 1000, nil, []string{"show"}, nil)
+	if !authorized || err != nil {
+		t.Errorf("Authorize() = %v, %v, want true, nil", authorized, err)
+	}
+}
+
+func TestRemovingProtocolSharingPluginFile(t *testing.T) {
+	a, cfgDir := loadAAA(t, map[string]string{
+		"e2e.json": `{"name": "e2e", "command-authorization": true}`,
+		"shared.json": `{"name": "shared", "file": "e2e", "symbol": "AAAPluginShared",
+			"command-authorization": true}`,
+	})
+	e2e, ok := a.Protocol("e2e")
+	if _, shared := a.Protocol("shared"); !ok || !shared {
+		t.Fatalf("Plugins not loaded, protocols: %v", a.ProtocolNames())
+	}
+
+	if err := os.Remove(filepath.Join(cfgDir, "shared.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err != nil {
+		t.Fatalf("Reload() = %v", err)
+	}
+
+	sym, err := e2e.LookupSymbol("AAAPluginShared")
+	if err != nil {
+		t.Fatalf("LookupSymbol() = %v", err)
+	}
+	shared := sym.(interface {
+		ValidUser(uint32, []string) (bool, error)
+	})
+	if _, err := shared.ValidUser(1000, nil); err == nil {
+		t.Error("Removed protocol sharing the plugin file was not torn down")
+	}
+	if valid, err := e2e.ValidUser(1000, nil); !valid || err != nil {
+		t.Errorf("Remaining protocol: ValidUser() = %v, %v, want true, nil", valid, err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+// A trivial AAA plugin for the end-to-end test of package e2e, built with
+// go build -buildmode=plugin. It is valid for users with a UID of at least
+// 1000, but only once set up and until torn down.
+
+package main
+
+import (
+	"errors"
+	"github.com/danos/aaa"
+	"github.com/danos/utils/pathutil"
+)
+
+type e2ePlugin struct {
+	setup bool
+}
+
+func (p *e2ePlugin) Setup() error {
+	p.setup = true
+	return nil
+}
+
+func (p *e2ePlugin) Teardown() error {
+	p.setup = false
+	return nil
+}
+
+func (p *e2ePlugin) ValidUser(uid uint32, groups []string) (bool, error) {
+	if !p.setup {
+		return false, errors.New("Plugin not set up")
+	}
+	return uid >= 1000, nil
+}
+
+func (p *e2ePlugin) NewTask(string, uint32, []string, []string,
+	*pathutil.PathAttrs, map[string]string) (aaa.AAATask, error) {
+	return aaa.NullPlugin{}.NewTask("", 0, nil, nil, nil, nil)
+}
+
+func (p *e2ePlugin) Account(string, uint32, []string, []string,
+	*pathutil.PathAttrs, map[string]string) error {
+	return nil
+}
+
+func (p *e2ePlugin) Authorize(string, uint32, []string, []string,
+	*pathutil.PathAttrs) (bool, error) {
+	return true, nil
+}
+
+func (p *e2ePlugin) Authenticate(string, string, map[string]string) (bool, error) {
+	return false, aaa.ErrAuthNotSupported
+}
+
+var AAAPluginAPIVersion uint32 = aaa.AAAPluginAPIVersion
+
+var AAAPluginV3 e2ePlugin
+
+// A second instance, for configs sharing the plugin file
+var AAAPluginShared e2ePlugin
+
+func main() {}
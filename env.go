@@ -0,0 +1,111 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The well-known env keys, see EnvTTY etc.
+var wellKnownEnvKeys = []string{EnvTTY, EnvRemoteAddr, EnvRemotePort, EnvSessionID,
+	EnvRequestID, EnvTaskID}
+
+// AAAPluginEnvKeys may optionally be implemented by an AAAPlugin to declare
+// which env keys it makes use of, so that callers need not populate others.
+type AAAPluginEnvKeys interface {
+	// Returns the env keys used by the plugin, typically a subset of the
+	// well-known keys (EnvTTY, EnvRemoteAddr, EnvRemotePort, EnvSessionID,
+	// EnvRequestID, EnvTaskID).
+	SupportedEnvKeys() []string
+}
+
+func (p *AAAProtocol) supportedEnvKeys() []string {
+	if !p.Capabilities().EnvKeys {
+		return wellKnownEnvKeys
+	}
+	e := unwrapAAAPlugin(p.Plugin).(AAAPluginEnvKeys)
+
+	var keys []string
+	err := callPlugin(func() error {
+		keys = e.SupportedEnvKeys()
+		return nil
+	})
+	if err != nil {
+		return wellKnownEnvKeys
+	}
+	return keys
+}
+
+// AAAPluginRequiredEnv may optionally be implemented by an AAAPlugin to
+// declare env keys without which it can not account a task completely, e.g.
+// EnvRemoteAddr. Tasks are then only created if env contains all of them, see
+// MissingEnvError.
+type AAAPluginRequiredEnv interface {
+	RequiredEnv() []string
+}
+
+// MissingEnvError is returned when creating a task for a protocol whose plugin
+// requires env keys which are not set, see AAAPluginRequiredEnv. Callers may
+// populate the keys and retry, or account the task otherwise.
+type MissingEnvError struct {
+	Name string
+	Keys []string
+}
+
+func (e *MissingEnvError) Error() string {
+	return fmt.Sprintf("Plugin %s requires env keys which are not set: %s",
+		e.Name, strings.Join(e.Keys, ", "))
+}
+
+// Checks that env contains the keys required by the protocol's plugin, if it
+// implements AAAPluginRequiredEnv
+func (p *AAAProtocol) checkRequiredEnv(env map[string]string) error {
+	if !p.Capabilities().RequiredEnv {
+		return nil
+	}
+	r := unwrapAAAPlugin(p.Plugin).(AAAPluginRequiredEnv)
+
+	var required []string
+	if err := callPlugin(func() error {
+		required = r.RequiredEnv()
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, key := range required {
+		if _, ok := env[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return &MissingEnvError{Name: p.Cfg.Name, Keys: missing}
+	}
+	return nil
+}
+
+// RequiredEnvKeys returns the sorted union of the env keys used by all loaded
+// protocols. Protocols whose plugin does not implement AAAPluginEnvKeys are
+// assumed to use all of the well-known keys.
+func (a *AAA) RequiredEnvKeys() []string {
+	set := make(map[string]bool)
+	for _, protocol := range a.OrderedProtocols() {
+		for _, key := range protocol.supportedEnvKeys() {
+			set[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"sort"
+)
+
+// ChangeKind is the kind of a ChangeEvent
+type ChangeKind int
+
+const (
+	// A protocol was added
+	ChangeAdded ChangeKind = iota
+	// A protocol was removed, e.g. because its config was removed or disabled
+	ChangeRemoved
+	// A protocol was replaced by a newly loaded instance
+	ChangeReloaded
+	// A protocol failed to load. Any previously loaded instance remains.
+	ChangeFailed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "Added"
+	case ChangeRemoved:
+		return "Removed"
+	case ChangeReloaded:
+		return "Reloaded"
+	case ChangeFailed:
+		return "Failed"
+	}
+	return "Unknown"
+}
+
+// ChangeEvent describes a change to the loaded protocols, see OnChange
+type ChangeEvent struct {
+	// Name of the protocol, or for ChangeFailed the config file if the
+	// config could not be read
+	Name string
+	Kind ChangeKind
+	// Error loading the protocol, for ChangeFailed
+	Err error
+}
+
+// OnChange registers fn to be called for each change to the protocols made by
+// Reload, ReloadProtocol and AddProtocol. Several functions may be
+// registered, and are called in the order of registration.
+//
+// On registration fn is called with a ChangeAdded event for each protocol
+// already loaded, e.g. by LoadAAA, in order of name, followed by a
+// ChangeFailed event for each config which failed to load in the last load or
+// Reload, in the order the configs were read.
+//
+// fn is called once each change has been made, but while further changes are
+// blocked, so must not call any of the methods which make them.
+func (a *AAA) OnChange(fn func(event ChangeEvent)) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	for _, name := range a.ProtocolNames() {
+		fn(ChangeEvent{Name: name, Kind: ChangeAdded})
+	}
+	a.mu.RLock()
+	failed := a.failed
+	a.mu.RUnlock()
+	for _, event := range failed {
+		fn(event)
+	}
+
+	a.mu.Lock()
+	a.listeners = append(a.listeners, fn)
+	a.mu.Unlock()
+}
+
+// Calls the functions registered with OnChange for each event
+func (a *AAA) notify(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	a.mu.RLock()
+	listeners := a.listeners
+	a.mu.RUnlock()
+
+	for _, fn := range listeners {
+		for _, event := range events {
+			fn(event)
+		}
+	}
+}
+
+// Returns the events turning previous into current, in order of name
+func diffProtocols(previous, current map[string]*AAAProtocol) []ChangeEvent {
+	var names []string
+	for name := range previous {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := previous[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var events []ChangeEvent
+	for _, name := range names {
+		prev, cur := previous[name], current[name]
+		switch {
+		case cur == nil:
+			events = append(events, ChangeEvent{Name: name, Kind: ChangeRemoved})
+		case prev == nil:
+			events = append(events, ChangeEvent{Name: name, Kind: ChangeAdded})
+		case prev != cur:
+			events = append(events, ChangeEvent{Name: name, Kind: ChangeReloaded})
+		}
+	}
+	return events
+}
+
+// Returns a ChangeFailed event for a config which failed to load
+func failedEvent(cfg AAAPluginConfig, file string, err error) ChangeEvent {
+	name := cfg.Name
+	if name == "" {
+		name = file
+	}
+	return ChangeEvent{Name: name, Kind: ChangeFailed, Err: err}
+}
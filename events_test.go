@@ -0,0 +1,37 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOnChangeReplaysLoadFailures(t *testing.T) {
+	cfgFS := fstest.MapFS{
+		"missing.json": {Data: []byte(`{"name": "missing", "command-accounting": true}`)},
+	}
+	a, err := loadAAAFS(cfgFS, t.TempDir(), loadOptions{})
+	var loadErrs LoadErrors
+	if !errors.As(err, &loadErrs) || len(loadErrs) != 1 {
+		t.Fatalf("loadAAAFS() = %v, want the missing plugin to fail", err)
+	}
+	if err := a.AddProtocol("mock", acctAuthorCfg, &mockPlugin{}); err != nil {
+		t.Fatalf("Unexpected error adding protocol: %v", err)
+	}
+
+	var events []ChangeEvent
+	a.OnChange(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+	if len(events) != 2 ||
+		events[0] != (ChangeEvent{Name: "mock", Kind: ChangeAdded}) ||
+		events[1].Name != "missing" || events[1].Kind != ChangeFailed ||
+		!errors.Is(events[1].Err, loadErrs[0]) {
+		t.Errorf("OnChange() replayed %v, want mock added and missing failed", events)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"github.com/danos/utils/pathutil"
+	"strings"
+)
+
+// FallbackAuthorizer authorizes paths with Primary, falling back to a local
+// policy when Primary can not make a decision, e.g. during an outage of every
+// authorization server.
+type FallbackAuthorizer struct {
+	Primary *AAA
+	// Consulted only when Primary.Authorize (or AuthorizeAny, see
+	// AuthorizeCtx) returns an error, never when a path is cleanly denied.
+	// May be nil, in which case the error is returned.
+	Fallback func(context string, uid uint32, groups []string, path []string,
+		pathAttrs *pathutil.PathAttrs) (bool, error)
+	// Logger to which each use of Fallback is reported. If nil, Primary's
+	// logger is used.
+	Logger Logger
+}
+
+// Authorize authorizes path as Primary.Authorize would, consulting Fallback
+// instead if that returns an error. Each use of Fallback is logged, with
+// secret path elements redacted, along with its decision.
+func (f *FallbackAuthorizer) Authorize(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs) (bool, error) {
+	authorized, err := f.Primary.Authorize(context, uid, groups, path, pathAttrs)
+	return f.fallback("", authorized, err, context, uid, groups, path, pathAttrs)
+}
+
+// AuthorizeCtx is like Authorize, but authorizes path as Primary.AuthorizeAny
+// would. Any correlation ID carried by ctx (see WithRequestID) is included in
+// the log lines.
+func (f *FallbackAuthorizer) AuthorizeCtx(ctx context.Context, aaaContext string,
+	uid uint32, groups []string, path []string, pathAttrs *pathutil.PathAttrs) (bool, error) {
+	authorized, err := f.Primary.AuthorizeAny(ctx, aaaContext, uid, groups, path, pathAttrs)
+	requestID, _ := RequestID(ctx)
+	return f.fallback(requestID, authorized, err, aaaContext, uid, groups, path, pathAttrs)
+}
+
+// Consults Fallback if Primary failed to authorize path with err
+func (f *FallbackAuthorizer) fallback(requestID string, authorized bool, err error,
+	context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (bool, error) {
+	if err == nil || f.Fallback == nil {
+		return authorized, err
+	}
+
+	logger := f.Logger
+	if logger == nil {
+		logger = f.Primary.log()
+	}
+	desc := strings.Join(RedactPath(path, pathAttrs), " ")
+	req := logRequestID(requestID)
+	logger.Printf("AAA authorization of %q for UID %d%s failed (%v), using fallback policy",
+		desc, uid, req, err)
+
+	authorized, err = f.Fallback(context, uid, groups, path, pathAttrs)
+	if err != nil {
+		logger.Printf("Fallback authorization of %q for UID %d%s failed: %v",
+			desc, uid, req, err)
+	} else {
+		logger.Printf("Fallback authorization of %q for UID %d%s: authorized %v",
+			desc, uid, req, authorized)
+	}
+	return authorized, err
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"github.com/danos/utils/pathutil"
+	"time"
+)
+
+// The following wrap calls into a protocol's plugin, converting any panic in
+// the plugin into an error. Plugins are often third-party code, and a faulty
+// one must not be able to take down the process. The calls are also subject
+// to MaxConcurrentPluginCalls.
+
+func (p *AAAProtocol) validUser(uid uint32, groups []string) (valid bool, err error) {
+	err = callPlugin(func() error {
+		var err error
+		valid, err = p.Plugin.ValidUser(uid, groups)
+		return err
+	})
+	p.tracef("ValidUser(%d, %q) = %v, %v", uid, groups, valid, err)
+	return valid, err
+}
+
+// Uses AAAPluginReason if supported by the plugin (see Capabilities),
+// otherwise the reason is empty.
+func (p *AAAProtocol) authorize(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs) (authorized bool, reason string, err error) {
+	return p.authorizeRequest("", context, uid, groups, path, pathAttrs)
+}
+
+// As authorize, tracing the call as part of the request with the given
+// correlation ID, if any
+func (p *AAAProtocol) authorizeRequest(requestID string, context string, uid uint32,
+	groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (authorized bool, reason string, err error) {
+	withReason := p.Capabilities().Reason
+	err = callPlugin(func() error {
+		var err error
+		if withReason {
+			r := unwrapAAAPlugin(p.Plugin).(AAAPluginReason)
+			authorized, reason, err = r.AuthorizeWithReason(context, uid, groups,
+				path, pathAttrs)
+		} else {
+			authorized, err = p.Plugin.Authorize(context, uid, groups, path, pathAttrs)
+		}
+		return err
+	})
+	if p.tracing() {
+		p.tracefRequest(requestID, "Authorize(%q, %d, %q, %q) = %v, %q, %v", context,
+			uid, groups, RedactPath(path, pathAttrs), authorized, reason, err)
+	}
+	return authorized, reason, err
+}
+
+func (p *AAAProtocol) authorizeCtx(c AAAPluginCtx, ctx context.Context, aaaContext string,
+	uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs) (authorized bool, err error) {
+	err = callPluginCtx(ctx, func() error {
+		var err error
+		authorized, err = c.AuthorizeCtx(ctx, aaaContext, uid, groups, path, pathAttrs)
+		return err
+	})
+	if p.tracing() {
+		requestID, _ := RequestID(ctx)
+		p.tracefRequest(requestID, "AuthorizeCtx(%q, %d, %q, %q) = %v, %v", aaaContext,
+			uid, groups, RedactPath(path, pathAttrs), authorized, err)
+	}
+	return authorized, err
+}
+
+func (p *AAAProtocol) authenticate(context string, user string,
+	credentials map[string]string) (ok bool, err error) {
+	err = callPlugin(func() error {
+		var err error
+		ok, err = p.Plugin.Authenticate(context, user, credentials)
+		return err
+	})
+	if p.tracing() {
+		p.tracef("Authenticate(%q, %q, credentials %s) = %v, %v", context, user,
+			mapKeys(credentials), ok, err)
+	}
+	return ok, err
+}
+
+func (p *AAAProtocol) newTask(context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	if err := p.checkRequiredEnv(env); err != nil {
+		return nil, err
+	}
+
+	var task AAATask
+	err := callPlugin(func() error {
+		var err error
+		task, err = p.Plugin.NewTask(context, uid, groups, path, pathAttrs, env)
+		return err
+	})
+	if p.tracing() {
+		p.tracefRequest(env[EnvRequestID], "NewTask(%q, %d, %q, %q, %v) = %v", context,
+			uid, groups, RedactPath(path, pathAttrs), redactEnv(env), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return guardedTask{task: task, protocol: p, requestID: env[EnvRequestID]}, nil
+}
+
+func (p *AAAProtocol) newTaskCtx(c AAAPluginCtx, ctx context.Context, aaaContext string,
+	uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	if err := p.checkRequiredEnv(env); err != nil {
+		return nil, err
+	}
+
+	var task AAATask
+	err := callPluginCtx(ctx, func() error {
+		var err error
+		task, err = c.NewTaskCtx(ctx, aaaContext, uid, groups, path, pathAttrs, env)
+		return err
+	})
+	if p.tracing() {
+		p.tracefRequest(env[EnvRequestID], "NewTaskCtx(%q, %d, %q, %q, %v) = %v",
+			aaaContext, uid, groups, RedactPath(path, pathAttrs), redactEnv(env), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return guardedTask{task: task, protocol: p, requestID: env[EnvRequestID]}, nil
+}
+
+type guardedTask struct {
+	task     AAATask
+	protocol *AAAProtocol
+	// Correlation ID of the request the task was created for, if any
+	requestID string
+	// Time after which each call into the task is abandoned, if positive
+	timeout time.Duration
+}
+
+// Calls fn, which calls into the task, through callPlugin, giving up waiting
+// for it once the task's timeout expires
+func (t guardedTask) call(fn func() error) error {
+	if t.timeout <= 0 {
+		return callPlugin(fn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- callPluginCtx(ctx, fn)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t guardedTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t guardedTask) AccountStart() error {
+	err := t.call(t.task.AccountStart)
+	t.protocol.tracefRequest(t.requestID, "AccountStart() = %v", err)
+	t.protocol.countAcct(OpAccountStart, err)
+	return err
+}
+
+func (t guardedTask) AccountStop(err *error) error {
+	stopErr := t.call(func() error {
+		return t.task.AccountStop(err)
+	})
+	if t.protocol.tracing() {
+		var taskErr error
+		if err != nil {
+			taskErr = *err
+		}
+		t.protocol.tracefRequest(t.requestID, "AccountStop(%v) = %v", taskErr, stopErr)
+	}
+	t.protocol.countAcct(OpAccountStop, stopErr)
+	return stopErr
+}
+
+func (t guardedTask) AccountStopResult(result TaskResult) error {
+	err := t.call(func() error {
+		return AccountStopWithResult(t.task, result)
+	})
+	t.protocol.tracefRequest(t.requestID, "AccountStopResult(exit code %d, %v) = %v",
+		result.ExitCode, result.Err, err)
+	t.protocol.countAcct(OpAccountStop, err)
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"testing"
+	"time"
+)
+
+var acctAuthorCfg = AAAPluginConfig{CmdAcct: true, CmdAuthor: true}
+
+func loadPanickingAAA(t *testing.T, method string) (*AAA, error) {
+	t.Helper()
+	a := NewAAA(nil)
+	plugin := &mockPlugin{panics: map[string]bool{method: true}}
+	return a, a.AddProtocol("mock", acctAuthorCfg, plugin)
+}
+
+func TestPanickingSetupSkipsProtocol(t *testing.T) {
+	a, err := loadPanickingAAA(t, "Setup")
+	if err == nil {
+		t.Error("Loading a plugin panicking in Setup did not fail")
+	}
+	if _, ok := a.Protocol("mock"); ok {
+		t.Error("Plugin panicking in Setup was loaded")
+	}
+}
+
+func TestPanickingPluginReturnsErrors(t *testing.T) {
+	tests := []struct {
+		method string
+		call   func(a *AAA) error
+	}{
+		{"ValidUser", func(a *AAA) error {
+			_, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+			return err
+		}},
+		{"Authorize", func(a *AAA) error {
+			authorized, err := a.Authorize("conf-mode", 1000, nil, []string{"show"}, nil)
+			if authorized {
+				t.Error("Plugin panicking in Authorize authorized the path")
+			}
+			return err
+		}},
+		{"NewTask", func(a *AAA) error {
+			_, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+			return err
+		}},
+		{"AccountStart", func(a *AAA) error {
+			task, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error creating task: %v", err)
+			}
+			return task.AccountStart()
+		}},
+		{"AccountStop", func(a *AAA) error {
+			task, err := a.NewRetryingTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error creating task: %v", err)
+			}
+			return task.AccountStop(nil)
+		}},
+		{"Authenticate", func(a *AAA) error {
+			_, err := a.Authenticate("conf-mode", "user", nil)
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			a, err := loadPanickingAAA(t, test.method)
+			if err != nil {
+				t.Fatalf("Unexpected error loading plugins: %v", err)
+			}
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("Panic in %s was not recovered: %v", test.method, r)
+				}
+			}()
+			if err := test.call(a); err == nil {
+				t.Errorf("Panic in %s was not returned as an error", test.method)
+			}
+		})
+	}
+}
+
+func TestPanickingProtocolIsSkipped(t *testing.T) {
+	panicking := &mockPlugin{panics: map[string]bool{"ValidUser": true, "Authorize": true}}
+	fallback := &mockPlugin{}
+	panickingCfg, fallbackCfg := acctAuthorCfg, acctAuthorCfg
+	panickingCfg.Priority, fallbackCfg.Priority = 1, 2
+	a := newMockAAA(t,
+		mockProtocol{"panicking", panickingCfg, panicking},
+		mockProtocol{"fallback", fallbackCfg, fallback},
+	)
+
+	authorized, source, err := a.AuthorizeWithSource("conf-mode", 1000, nil,
+		[]string{"show"}, nil)
+	if !authorized || source != "fallback" || err != nil {
+		t.Errorf("Authorize() = %v, %q, %v, want authorized by fallback",
+			authorized, source, err)
+	}
+
+	task, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating task: %v", err)
+	}
+	task.AccountStart()
+	task.AccountStop(nil)
+	if got := fallback.lastTask(); got == nil || got.starts != 1 || got.stops != 1 {
+		t.Errorf("Task not accounted by fallback protocol: %+v", got)
+	}
+}
+
+func TestValidUserPanicIsNotCached(t *testing.T) {
+	clock := &mockClock{now: time.Unix(0, 0)}
+	defer setClock(setClock(clock))
+
+	plugin := &mockPlugin{}
+	cfg := acctAuthorCfg
+	cfg.ValidUserCacheSeconds = 60
+	a := newMockAAA(t, mockProtocol{"mock", cfg, plugin})
+	protocol, _ := a.Protocol("mock")
+
+	plugin.panics = map[string]bool{"ValidUser": true}
+	if _, err := protocol.ValidUser(1000, nil); err == nil {
+		t.Fatal("Panic in ValidUser was not returned as an error")
+	}
+	plugin.panics = nil
+
+	for i := 0; i < 2; i++ {
+		if valid, err := protocol.ValidUser(1000, nil); !valid || err != nil {
+			t.Fatalf("ValidUser() = %v, %v, want true, nil", valid, err)
+		}
+	}
+	if got := plugin.validUserCalls(); got != 1 {
+		t.Errorf("Plugin's ValidUser called %d times, want 1 after the panic", got)
+	}
+
+	clock.Advance(61 * time.Second)
+	protocol.ValidUser(1000, nil)
+	if got := plugin.validUserCalls(); got != 2 {
+		t.Errorf("Plugin's ValidUser called %d times, want 2 once cache expired", got)
+	}
+}
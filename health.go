@@ -0,0 +1,78 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Returned, wrapped with the error of its last health check, for a protocol
+// skipped by authorization because it is unhealthy, see
+// AuthzPolicy.SkipUnhealthy
+var ErrProtocolUnhealthy = errors.New("AAA protocol is unhealthy")
+
+// HealthChecker may optionally be implemented by an AAAPlugin to report
+// whether its backend (e.g. a TACACS+ server) is usable.
+type HealthChecker interface {
+	// Should return an error if the plugin is currently unable to serve
+	// requests.
+	HealthCheck() error
+}
+
+// Checks the health of the protocol's plugin, recording the result.
+// Plugins which do not support HealthChecker (see Capabilities) are always
+// healthy.
+func (p *AAAProtocol) checkHealth() error {
+	var err error
+	if p.Capabilities().HealthCheck {
+		h := unwrapAAAPlugin(p.Plugin).(HealthChecker)
+		err = callPlugin(h.HealthCheck)
+	}
+
+	p.healthMu.Lock()
+	p.healthErr = err
+	p.healthMu.Unlock()
+
+	return err
+}
+
+// Reports whether the protocol passed its last health check. Protocols are
+// considered healthy until checked.
+func (p *AAAProtocol) healthy() bool {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+
+	return p.healthErr == nil
+}
+
+// Returns an error wrapping ErrProtocolUnhealthy if skip is set and the
+// protocol failed its last health check
+func (p *AAAProtocol) skipIfUnhealthy(skip bool) error {
+	if !skip {
+		return nil
+	}
+	p.healthMu.Lock()
+	err := p.healthErr
+	p.healthMu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %v", ErrProtocolUnhealthy, p.Cfg.Name, err)
+}
+
+// CheckHealth checks the health of each loaded protocol, returning the result
+// keyed by protocol name. Healthy protocols map to a nil error.
+// The results are also reflected by ProtocolInfo, and unhealthy protocols may
+// be skipped by authorization, see AuthzPolicy.SkipUnhealthy.
+func (a *AAA) CheckHealth() map[string]error {
+	health := make(map[string]error)
+	for _, protocol := range a.OrderedProtocols() {
+		health[protocol.Cfg.Name] = protocol.checkHealth()
+	}
+	return health
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+)
+
+// Go's plugin package can not unload a plugin, and returns the plugin already
+// opened from a path when the same path is opened again, even if the file has
+// since been replaced. To load a replaced plugin binary it is copied to a
+// private temporary path and opened from there. Plugins are keyed by path and
+// content hash, so re-opening an unchanged binary returns the plugin already
+// loaded.
+//
+// The code of a replaced plugin remains mapped for the lifetime of the
+// process. A replacement is also subject to the restrictions of the plugin
+// package: it fails to load with "plugin already loaded" unless its plugin
+// path differs from that of the binary it replaces, and any packages the two
+// share must be unchanged. A plugin built from a list of files, e.g.
+// "go build -buildmode=plugin main.go", has a plugin path derived from the
+// contents of the files, so a modified build can be loaded; one built from a
+// package has the package's import path as its plugin path, so it can not.
+var openedPlugins struct {
+	mu sync.Mutex
+	// Content hash of the binary each path was first opened with
+	first map[string]string
+	// Plugins opened, by path and content hash
+	handles map[openedPluginKey]*plugin.Plugin
+}
+
+type openedPluginKey struct {
+	path string
+	sum  string
+}
+
+// Opens the plugin at path, returning it along with the sha256 hash of the
+// binary opened. If want is set the binary must have that hash, and is opened
+// from a private copy verified while copying, so that the file can not be
+// replaced between being verified and being opened.
+func openPluginFile(path, want string) (*plugin.Plugin, string, error) {
+	sum := strings.ToLower(want)
+	if sum == "" {
+		var err error
+		if sum, err = sha256File(path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	openedPlugins.mu.Lock()
+	defer openedPlugins.mu.Unlock()
+
+	key := openedPluginKey{path: path, sum: sum}
+	if p, ok := openedPlugins.handles[key]; ok {
+		return p, sum, nil
+	}
+
+	openPath := path
+	if _, ok := openedPlugins.first[path]; ok || want != "" {
+		dir, err := os.MkdirTemp("", "aaa-plugin-")
+		if err != nil {
+			return nil, "", err
+		}
+		// The plugin remains loaded once the copy is removed
+		defer os.RemoveAll(dir)
+
+		openPath = filepath.Join(dir, filepath.Base(path))
+		got, err := copyPluginFile(openPath, path)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case got == sum:
+		case want != "":
+			return nil, "", &IntegrityError{Path: path, Want: want, Got: got}
+		default:
+			return nil, "", fmt.Errorf("Plugin %s changed while being loaded", path)
+		}
+	}
+
+	p, err := plugin.Open(openPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if openedPlugins.first == nil {
+		openedPlugins.first = make(map[string]string)
+		openedPlugins.handles = make(map[openedPluginKey]*plugin.Plugin)
+	}
+	if _, ok := openedPlugins.first[path]; !ok {
+		openedPlugins.first[path] = sum
+	}
+	openedPlugins.handles[key] = p
+	return p, sum, nil
+}
+
+// Copies the plugin at src to dst, returning the sha256 hash of the copy
+func copyPluginFile(dst, src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Reports whether the protocol's plugin file has been replaced by a different
+// binary since it was loaded. The file is only hashed if its modification time
+// has changed, and replacing it with an identical binary is not a change.
+func (p *AAAProtocol) pluginChanged(pluginDir string) bool {
+	if p.pluginSum == "" {
+		return false
+	}
+
+	path, err := pluginPath(pluginDir, p.Cfg.pluginFile())
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.ModTime().Equal(p.PluginModTime) {
+		return false
+	}
+	sum, err := sha256File(path)
+	return err == nil && sum != p.pluginSum
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// When set, plugins are only loaded if their config specifies a sha256
+// checksum, and the plugin file matches it.
+var RequireChecksums bool
+
+// Names of the plugins which may be loaded from plugin files. Configs naming
+// any other plugin fail to load with a PluginNotAllowedError. Empty allows
+// every plugin.
+var AllowedPlugins []string
+
+// PluginNotAllowedError is returned for plugins not listed in AllowedPlugins
+type PluginNotAllowedError struct {
+	Name string
+}
+
+func (e *PluginNotAllowedError) Error() string {
+	return fmt.Sprintf("Plugin %s is not in the list of allowed plugins", e.Name)
+}
+
+// Checks that the named plugin may be loaded, see AllowedPlugins
+func checkPluginAllowed(name string) error {
+	if len(AllowedPlugins) == 0 {
+		return nil
+	}
+	for _, allowed := range AllowedPlugins {
+		if name == allowed {
+			return nil
+		}
+	}
+	return &PluginNotAllowedError{Name: name}
+}
+
+// IntegrityError is returned when a plugin fails checksum verification.
+// Want is empty if no checksum was configured but RequireChecksums is set.
+type IntegrityError struct {
+	Name string
+	Path string
+	Want string
+	Got  string
+}
+
+func (e *IntegrityError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("No sha256 checksum configured for plugin %s", e.Name)
+	}
+	return fmt.Sprintf("Checksum mismatch for plugin %s (%s): sha256 %s, expected %s",
+		e.Name, e.Path, e.Got, e.Want)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verifies the plugin at path against the checksum in cfg, if any
+func verifyPluginChecksum(path string, cfg AAAPluginConfig) error {
+	if cfg.Sha256 == "" {
+		if RequireChecksums {
+			return &IntegrityError{Name: cfg.Name, Path: path}
+		}
+		return nil
+	}
+
+	sum, err := sha256File(path)
+	if err != nil {
+		return fmt.Errorf("Could not checksum plugin: %v", err)
+	}
+	if !strings.EqualFold(sum, cfg.Sha256) {
+		return &IntegrityError{Name: cfg.Name, Path: path, Want: cfg.Sha256, Got: sum}
+	}
+	return nil
+}
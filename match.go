@@ -0,0 +1,112 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MatchGroups reports whether any of userGroups matches any of patterns, for
+// use by plugins implementing ValidUser.
+//
+// Patterns are shell-style globs (see path.Match), matched case-sensitively.
+// Malformed patterns match nothing. An empty pattern list matches every user,
+// including one with no groups; otherwise a user with no groups never matches.
+func MatchGroups(userGroups []string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		for _, group := range userGroups {
+			if ok, _ := path.Match(pattern, group); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type uidRange struct {
+	min, max uint32
+}
+
+func parseUID(s string) (uint32, error) {
+	uid, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid UID %q", s)
+	}
+	return uint32(uid), nil
+}
+
+func parseUIDRange(s string) (uidRange, error) {
+	r := uidRange{0, math.MaxUint32}
+	s = strings.TrimSpace(s)
+
+	var err error
+	switch {
+	case strings.HasPrefix(s, ">="):
+		r.min, err = parseUID(s[2:])
+	case strings.HasPrefix(s, "<="):
+		r.max, err = parseUID(s[2:])
+	case strings.HasPrefix(s, ">"):
+		r.min, err = parseUID(s[1:])
+		if err == nil && r.min == math.MaxUint32 {
+			return r, fmt.Errorf("Empty UID range %q", s)
+		}
+		r.min++
+	case strings.HasPrefix(s, "<"):
+		r.max, err = parseUID(s[1:])
+		if err == nil && r.max == 0 {
+			return r, fmt.Errorf("Empty UID range %q", s)
+		}
+		r.max--
+	case strings.Contains(s, "-"):
+		bounds := strings.SplitN(s, "-", 2)
+		if r.min, err = parseUID(bounds[0]); err == nil {
+			r.max, err = parseUID(bounds[1])
+		}
+		if err == nil && r.min > r.max {
+			return r, fmt.Errorf("Empty UID range %q", s)
+		}
+	default:
+		r.min, err = parseUID(s)
+		r.max = r.min
+	}
+	if err != nil {
+		return r, fmt.Errorf("Invalid UID range %q: %s", s, err)
+	}
+	return r, nil
+}
+
+// UIDInRanges reports whether uid lies within any of ranges, for use by
+// plugins implementing ValidUser.
+//
+// Each range is a single UID (e.g. "0"), an inclusive range ("1000-2000"),
+// or a bound (">=500", ">499", "<=999", "<1000"). Ranges may overlap. An
+// error is returned if any range is malformed, regardless of whether uid lies
+// within the others. An empty range list matches no user.
+func UIDInRanges(uid uint32, ranges []string) (bool, error) {
+	parsed := make([]uidRange, 0, len(ranges))
+	for _, s := range ranges {
+		r, err := parseUIDRange(s)
+		if err != nil {
+			return false, err
+		}
+		parsed = append(parsed, r)
+	}
+
+	for _, r := range parsed {
+		if uid >= r.min && uid <= r.max {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// Name of an optional file in the plugin config directory holding a JSON
+// array of plugin configs. Each entry is treated as though it was a separate
+// config file, sorted in place of the merged file, and is referred to as e.g.
+// plugins.json[0] in errors.
+const AAAPluginsMergedCfgFile = "plugins.json"
+
+func mergedCfgEntryName(i int) string {
+	return fmt.Sprintf("%s[%d]", AAAPluginsMergedCfgFile, i)
+}
+
+// Reports whether name refers to the merged config file or one of its entries
+func isMergedCfgName(name string) bool {
+	return name == AAAPluginsMergedCfgFile ||
+		strings.HasPrefix(name, AAAPluginsMergedCfgFile+"[")
+}
+
+// Returns the file in the config directory holding the named config
+func cfgFileName(name string) string {
+	if isMergedCfgName(name) {
+		return AAAPluginsMergedCfgFile
+	}
+	return name
+}
+
+func parseMergedCfgEntryName(name string) (int, bool) {
+	idx := strings.TrimPrefix(name, AAAPluginsMergedCfgFile+"[")
+	if idx == name || !strings.HasSuffix(idx, "]") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+	return i, err == nil && i >= 0
+}
+
+func readMergedAAAPluginConfigs(cfgFS fs.FS) ([]json.RawMessage, error) {
+	if err := checkCfgFileTarget(cfgFS, AAAPluginsMergedCfgFile); err != nil {
+		return nil, err
+	}
+
+	f, e := cfgFS.Open(AAAPluginsMergedCfgFile)
+	if e != nil {
+		err := fmt.Errorf("Failed opening merged plugin config file: %s", e)
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []json.RawMessage
+	if e := json.NewDecoder(limitCfgFile(f)).Decode(&entries); e != nil {
+		err := fmt.Errorf("Failed to decode merged plugin config file: %w", e)
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readMergedAAAPluginConfig(cfgFS fs.FS, name string,
+	defaults AAAPluginConfig) (AAAPluginConfig, error) {
+	entries, err := readMergedAAAPluginConfigs(cfgFS)
+	if err != nil {
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+
+	i, ok := parseMergedCfgEntryName(name)
+	if !ok || i >= len(entries) {
+		err := fmt.Errorf("No such entry in merged plugin config file")
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	return decodeAAAPluginConfig(bytes.NewReader(entries[i]), defaults)
+}
+
+// Returns the names of all plugin configs in cfgFS in the order they are
+// loaded, i.e. the config files sorted lexically with the merged config file
+// replaced by its entries. A merged config file which can not be read is
+// listed as is, so that the error is reported when reading its config.
+func readAAAPluginCfgNames(cfgFS fs.FS) ([]string, error) {
+	files, err := readAAAPluginsCfgDir(cfgFS)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file != AAAPluginsMergedCfgFile {
+			names = append(names, file)
+			continue
+		}
+		entries, err := readMergedAAAPluginConfigs(cfgFS)
+		if err != nil {
+			names = append(names, file)
+			continue
+		}
+		for i := range entries {
+			names = append(names, mergedCfgEntryName(i))
+		}
+	}
+	return names, nil
+}
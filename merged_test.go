@@ -0,0 +1,57 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// A config directory listing its entries in reverse order, as some
+// filesystems list them in no particular order
+type unsortedDirFS struct {
+	fstest.MapFS
+}
+
+func (f unsortedDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := f.MapFS.ReadDir(name)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() > entries[j].Name()
+	})
+	return entries, err
+}
+
+func TestCfgFileOrderIsLexical(t *testing.T) {
+	cfg := &fstest.MapFile{Data: []byte(`{"name": "x", "command-accounting": true}`)}
+	cfgFS := unsortedDirFS{fstest.MapFS{
+		"20-radius.json":          cfg,
+		"10-tacplus.json":         cfg,
+		"3-local.yaml":            cfg,
+		"plugins.json":            {Data: []byte(`[{"name": "a"}, {"name": "b"}]`)},
+		AAAPluginsDefaultsCfgFile: {Data: []byte(`{}`)},
+		"README":                  {Data: []byte(`not a config`)},
+	}}
+	want := []string{
+		"10-tacplus.json",
+		"20-radius.json",
+		"3-local.yaml",
+		"plugins.json[0]",
+		"plugins.json[1]",
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := readAAAPluginCfgNames(cfgFS)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("readAAAPluginCfgNames() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A protocol added by newMockAAA
+type mockProtocol struct {
+	name   string
+	cfg    AAAPluginConfig
+	plugin *mockPlugin
+}
+
+// Returns an AAA with the given protocols added, failing the test if any
+// fails to set up
+func newMockAAA(t *testing.T, protocols ...mockProtocol) *AAA {
+	t.Helper()
+	a := NewAAA(nil)
+	for _, p := range protocols {
+		if err := a.AddProtocol(p.name, p.cfg, p.plugin); err != nil {
+			t.Fatalf("Unexpected error adding protocol %s: %v", p.name, err)
+		}
+	}
+	return a
+}
+
+// mockPlugin is a plugin for tests which is valid for every user unless
+// invalid is set, and authorizes everything unless deny is set. Its methods
+// named in panics panic instead, as do those of its tasks. If block is set its
+// tasks' AccountStart waits until it is closed. Its health check returns
+// unhealthy.
+type mockPlugin struct {
+	invalid   bool
+	deny      bool
+	panics    map[string]bool
+	block     chan struct{}
+	unhealthy error
+
+	mu         sync.Mutex
+	validUsers int
+	tasks      []*mockTask
+}
+
+func (m *mockPlugin) maybePanic(method string) {
+	if m.panics[method] {
+		panic("mock plugin " + method)
+	}
+}
+
+func (m *mockPlugin) Setup() error {
+	m.maybePanic("Setup")
+	return nil
+}
+
+func (m *mockPlugin) ValidUser(uint32, []string) (bool, error) {
+	m.maybePanic("ValidUser")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.validUsers++
+	return !m.invalid, nil
+}
+
+func (m *mockPlugin) NewTask(_ string, _ uint32, _ []string, _ []string,
+	_ *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	m.maybePanic("NewTask")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task := &mockTask{plugin: m, env: env}
+	m.tasks = append(m.tasks, task)
+	return task, nil
+}
+
+func (m *mockPlugin) Account(string, uint32, []string, []string,
+	*pathutil.PathAttrs, map[string]string) error {
+	m.maybePanic("Account")
+	return nil
+}
+
+func (m *mockPlugin) Authorize(string, uint32, []string, []string,
+	*pathutil.PathAttrs) (bool, error) {
+	m.maybePanic("Authorize")
+	return !m.deny, nil
+}
+
+func (m *mockPlugin) Authenticate(string, string, map[string]string) (bool, error) {
+	m.maybePanic("Authenticate")
+	return false, ErrAuthNotSupported
+}
+
+func (m *mockPlugin) HealthCheck() error {
+	m.maybePanic("HealthCheck")
+	return m.unhealthy
+}
+
+func (m *mockPlugin) validUserCalls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.validUsers
+}
+
+func (m *mockPlugin) lastTask() *mockTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.tasks) == 0 {
+		return nil
+	}
+	return m.tasks[len(m.tasks)-1]
+}
+
+// mockTask records the accounting of a task of a mockPlugin. It only
+// implements AccountStop(*error), as tasks of older plugins do.
+type mockTask struct {
+	plugin *mockPlugin
+	env    map[string]string
+
+	starts  int
+	stops   int
+	stopErr error
+}
+
+func (t *mockTask) AccountStart() error {
+	t.plugin.maybePanic("AccountStart")
+	if t.plugin.block != nil {
+		<-t.plugin.block
+	}
+	t.starts++
+	return nil
+}
+
+func (t *mockTask) AccountStop(err *error) error {
+	t.plugin.maybePanic("AccountStop")
+	t.stops++
+	t.stopErr = nil
+	if err != nil {
+		t.stopErr = *err
+	}
+	return nil
+}
+
+// mockClock is a manually advanced clock, for use with setClock
+type mockClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *mockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
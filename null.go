@@ -0,0 +1,105 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"fmt"
+	"github.com/danos/utils/pathutil"
+)
+
+// NullPlugin is an AAAPlugin which does nothing: it is valid for no user,
+// authorizes nothing and creates tasks which account nothing.
+// It is intended for use in tests and as a fallback.
+type NullPlugin struct{}
+
+func (NullPlugin) Setup() error {
+	return nil
+}
+
+func (NullPlugin) ValidUser(uint32, []string) (bool, error) {
+	return false, nil
+}
+
+func (NullPlugin) NewTask(string, uint32, []string, []string,
+	*pathutil.PathAttrs, map[string]string) (AAATask, error) {
+	return nullTask{}, nil
+}
+
+func (NullPlugin) Account(string, uint32, []string, []string,
+	*pathutil.PathAttrs, map[string]string) error {
+	return nil
+}
+
+func (NullPlugin) Authorize(string, uint32, []string, []string,
+	*pathutil.PathAttrs) (bool, error) {
+	return false, nil
+}
+
+func (NullPlugin) Authenticate(string, string, map[string]string) (bool, error) {
+	return false, ErrAuthNotSupported
+}
+
+type nullTask struct{}
+
+func (nullTask) AccountStart() error {
+	return nil
+}
+
+func (nullTask) AccountStop(*error) error {
+	return nil
+}
+
+// NewAAA builds an AAA from the given in-memory protocols, without loading any
+// plugins. The protocols' plugins are used as they are; Setup is not called.
+func NewAAA(protocols map[string]*AAAProtocol) *AAA {
+	aaa := &AAA{Protocols: make(map[string]*AAAProtocol, len(protocols))}
+	for name, protocol := range protocols {
+		aaa.Protocols[name] = protocol
+	}
+	return aaa
+}
+
+// AddProtocol sets up an already constructed plugin, e.g. one linked into
+// the binary, and adds it as a protocol with the given name and config. This
+// allows AAA to be used without loading plugin files.
+//
+// The name overrides any name in cfg, and a zero Priority is taken to be
+// DefaultPriority, as for a config file which does not set it. An error is
+// returned if cfg is not valid, a protocol with the name already exists, or
+// the plugin fails to set up. The protocol is left in place by Reload.
+func (a *AAA) AddProtocol(name string, cfg AAAPluginConfig, p AAAPlugin) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	cfg.Name = name
+	if cfg.Priority == 0 {
+		cfg.Priority = DefaultPriority
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if _, ok := a.Protocol(name); ok {
+		return fmt.Errorf("AAA protocol %s already exists", name)
+	}
+
+	protocol := &AAAProtocol{Cfg: cfg, Plugin: p}
+	if err := a.setupAAAProtocol(context.Background(), name, protocol); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	if a.Protocols == nil {
+		a.Protocols = make(map[string]*AAAProtocol)
+	}
+	a.Protocols[name] = protocol
+	a.mu.Unlock()
+	a.FlushAuthzCache()
+	a.applyDebug()
+
+	a.notify([]ChangeEvent{{Name: name, Kind: ChangeAdded}})
+	return nil
+}
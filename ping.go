@@ -0,0 +1,52 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+// AAAPluginPinger may optionally be implemented by an AAAPlugin to check
+// whether its backend (e.g. a TACACS+ server) is reachable, as Setup may
+// succeed without contacting it.
+type AAAPluginPinger interface {
+	// Should return an error if the backend can not be reached. Ping is
+	// called while loading, so should give up after a short time.
+	Ping() error
+}
+
+// If set, each protocol's backend is pinged once the protocol is set up by the
+// LoadAAA functions, Reload, ReloadProtocol or AddProtocol, see
+// AAAPluginPinger. An unreachable backend is logged as a warning, but the
+// protocol is still loaded. The result is reported by ProtocolInfo.Reachable.
+var PingOnSetup bool
+
+// Pings the protocol's backend, if its plugin implements AAAPluginPinger,
+// recording the result
+func (p *AAAProtocol) pingBackend(name string, logger Logger) {
+	if !p.Capabilities().Ping {
+		return
+	}
+	pinger := unwrapAAAPlugin(p.Plugin).(AAAPluginPinger)
+	err := callPlugin(pinger.Ping)
+	if err != nil {
+		logger.Printf("Warning: Backend of plugin %s is unreachable: %v", name, err)
+	}
+
+	p.healthMu.Lock()
+	p.pinged = true
+	p.pingErr = err
+	p.healthMu.Unlock()
+}
+
+// Reports whether the protocol's backend was reachable when pinged, or nil if
+// it was not pinged
+func (p *AAAProtocol) reachable() *bool {
+	p.healthMu.Lock()
+	defer p.healthMu.Unlock()
+
+	if !p.pinged {
+		return nil
+	}
+	reachable := p.pingErr == nil
+	return &reachable
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+)
+
+// ProbeResult is the outcome of probing a single protocol, see Probe
+type ProbeResult struct {
+	Name string
+	// Whether the protocol is valid for the user. Authorize is only
+	// consulted if it is.
+	ValidUser  bool
+	Authorized bool
+	// Reason given for the decision, see AAAPluginReason
+	Reason string
+	// Error from ValidUser or Authorize, if any
+	Err error
+}
+
+// Probe authorizes path with every protocol which Authorize would consult, in
+// the same order, without stopping at the first decision. It is intended for
+// diagnosing authorization decisions.
+//
+// Probe does not consult or populate the ValidUser and authorization caches.
+func (a *AAA) Probe(context string, uid uint32, groups []string, path []string,
+	attrs *pathutil.PathAttrs) []ProbeResult {
+	context = normalizeContext(context)
+	skipUnhealthy := a.getAuthzPolicy().SkipUnhealthy
+	var results []ProbeResult
+	for _, protocol := range a.OrderedProtocols() {
+		if !protocol.Cfg.CmdAuthor || !protocol.Cfg.appliesTo(context) {
+			continue
+		}
+
+		r := ProbeResult{Name: protocol.Cfg.Name}
+		if r.Err = protocol.skipIfUnhealthy(skipUnhealthy); r.Err != nil {
+			results = append(results, r)
+			continue
+		}
+		r.ValidUser, r.Err = protocol.validUser(uid, groups)
+		if r.Err == nil && r.ValidUser {
+			r.Authorized, r.Reason, r.Err = protocol.authorize(context, uid, groups,
+				path, attrs)
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned by Authorize and its variants for users exceeding the authorization
+// rate limit, see SetAuthzRateLimit
+var ErrRateLimited = errors.New("Authorization rate limit exceeded")
+
+// Number of users tracked by the rate limiter before the buckets of users who
+// are not being limited are forgotten
+const maxRateLimitBuckets = 1024
+
+// AuthzRateLimitOptions configures the per-user limit on authorization
+// requests, see SetAuthzRateLimit
+type AuthzRateLimitOptions struct {
+	// Requests per second allowed for each user; zero disables the limit
+	Rate float64
+	// Requests a user may make at once after being idle; at least 1
+	Burst int
+	// Whether a request exceeding the limit waits until it is allowed,
+	// rather than failing with ErrRateLimited
+	Block bool
+	// Users with a UID below this, e.g. system users, are not limited
+	ExemptBelowUID uint32
+}
+
+// SetAuthzRateLimit limits the rate at which each user's authorization
+// requests consult the protocols, protecting their servers from runaway
+// clients. Each user has a token bucket holding up to Burst tokens, refilled
+// at Rate tokens per second, and each request consulting the protocols takes
+// a token. Decisions answered from the authorization cache or by the
+// DefaultDecision are not limited. AuthorizeBatch takes one token per batch,
+// except in RequireAll mode, where it takes one per path.
+//
+// A request for which no token is available fails with ErrRateLimited, or if
+// Block is set waits for a token, giving up once the context passed to
+// AuthorizeAny is done.
+func (a *AAA) SetAuthzRateLimit(opts AuthzRateLimitOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if opts.Rate <= 0 {
+		a.authzLimiter = nil
+		return
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	a.authzLimiter = &rateLimiter{
+		opts:    opts,
+		buckets: make(map[uint32]*tokenBucket),
+	}
+}
+
+func (a *AAA) getAuthzLimiter() *rateLimiter {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.authzLimiter
+}
+
+// Takes a token for a request by uid, if rate limiting is enabled
+func (a *AAA) limitAuthz(uid uint32) error {
+	return a.limitAuthzCtx(context.Background(), uid)
+}
+
+// As limitAuthz, giving up waiting for a token once ctx is done
+func (a *AAA) limitAuthzCtx(ctx context.Context, uid uint32) error {
+	l := a.getAuthzLimiter()
+	if l == nil || uid < l.opts.ExemptBelowUID {
+		return nil
+	}
+	return l.wait(ctx, uid)
+}
+
+type rateLimiter struct {
+	opts    AuthzRateLimitOptions
+	mu      sync.Mutex
+	buckets map[uint32]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) wait(ctx context.Context, uid uint32) error {
+	for {
+		delay, ok := l.take(uid)
+		if ok {
+			return nil
+		}
+		if !l.opts.Block {
+			return ErrRateLimited
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Takes a token from uid's bucket, or returns how long until one is available
+func (l *rateLimiter) take(uid uint32) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := timeNow()
+	b, ok := l.buckets[uid]
+	if !ok {
+		l.prune(now)
+		b = &tokenBucket{tokens: float64(l.opts.Burst), last: now}
+		l.buckets[uid] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	delay := time.Duration((1 - b.tokens) / l.opts.Rate * float64(time.Second))
+	return delay, false
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * l.opts.Rate
+		if burst := float64(l.opts.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+}
+
+// Forgets the buckets which have refilled once too many users are tracked, as
+// they are equivalent to new buckets
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) < maxRateLimitBuckets {
+		return
+	}
+	for uid, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.opts.Burst) {
+			delete(l.buckets, uid)
+		}
+	}
+}
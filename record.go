@@ -0,0 +1,118 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"github.com/danos/utils/pathutil"
+	"time"
+)
+
+// AccountRecord is a protocol independent description of an accounted task,
+// see AAAPluginAccountRecord. It is serialized to JSON with encoding/json.
+type AccountRecord struct {
+	// See TaskID
+	TaskID  string   `json:"task-id"`
+	Context string   `json:"context"`
+	UID     uint32   `json:"uid"`
+	Groups  []string `json:"groups"`
+	// Path of the task, with secret elements redacted as by RedactPath
+	Path []string `json:"path"`
+	// How the path was authorized, if auditing is enabled (see
+	// SetAuthzAudit), otherwise empty
+	Authorization AuthzOutcome `json:"authorization,omitempty"`
+	StartTime     time.Time    `json:"start-time"`
+	// Zero in the record of the start of a task
+	StopTime time.Time `json:"stop-time"`
+	ExitCode int       `json:"exit-code"`
+	// Error the task failed with, if any
+	Err string            `json:"error,omitempty"`
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// AAAPluginAccountRecord may optionally be implemented by an AAAPlugin to
+// receive an AccountRecord for tasks created by NewTimedTask, NewRetryingTask
+// and RunAccounted, in addition to the task's own accounting. A record is
+// passed once the task's AccountStart succeeds, and again with the stop time
+// and outcome filled in once its AccountStop succeeds.
+type AAAPluginAccountRecord interface {
+	AccountRecord(rec AccountRecord) error
+}
+
+// Returns the record of a task created with the given parameters
+func (a *AAA) newAccountRecord(id, context string, uid uint32, groups []string,
+	path []string, pathAttrs *pathutil.PathAttrs, env map[string]string) AccountRecord {
+	return AccountRecord{
+		TaskID:        id,
+		Context:       context,
+		UID:           uid,
+		Groups:        groups,
+		Path:          RedactPath(path, pathAttrs),
+		Authorization: a.authzOutcome(context, uid, groups, path, pathAttrs),
+		Env:           env,
+	}
+}
+
+// Wraps task so that the protocol's plugin also receives rec for it, if it
+// implements AAAPluginAccountRecord
+func (p *AAAProtocol) recordTask(task AAATask, rec AccountRecord) AAATask {
+	if !p.Capabilities().AccountRecord {
+		return task
+	}
+	return &recordingTask{task: task, protocol: p, rec: rec}
+}
+
+func (p *AAAProtocol) accountRecord(rec AccountRecord) error {
+	r := unwrapAAAPlugin(p.Plugin).(AAAPluginAccountRecord)
+	return callPlugin(func() error {
+		return r.AccountRecord(rec)
+	})
+}
+
+type recordingTask struct {
+	task     AAATask
+	protocol *AAAProtocol
+	rec      AccountRecord
+}
+
+func (t *recordingTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t *recordingTask) AccountStart() error {
+	t.rec.StartTime = timeNow()
+	if err := t.task.AccountStart(); err != nil {
+		return err
+	}
+	return t.protocol.accountRecord(t.rec)
+}
+
+func (t *recordingTask) AccountStop(err *error) error {
+	result := TaskResult{}
+	if err != nil {
+		result.Err = *err
+	}
+	if e := t.task.AccountStop(err); e != nil {
+		return e
+	}
+	return t.stopped(result)
+}
+
+func (t *recordingTask) AccountStopResult(result TaskResult) error {
+	if err := AccountStopWithResult(t.task, result); err != nil {
+		return err
+	}
+	return t.stopped(result)
+}
+
+func (t *recordingTask) stopped(result TaskResult) error {
+	rec := t.rec
+	rec.StopTime = timeNow()
+	rec.ExitCode = result.ExitCode
+	if result.Err != nil {
+		rec.Err = result.Err.Error()
+	}
+	return t.protocol.accountRecord(rec)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+// ProtocolStats counts the outcomes of a protocol's operations. Authorization
+// outcomes are counted for requests made by Authorize and its variants and
+// AuthorizeAny, excluding those answered from the authorization cache.
+// Accounting outcomes are counted for all tasks instantiated through the
+// protocol.
+type ProtocolStats struct {
+	AuthzAllowed    uint64 `json:"authorization-allowed"`
+	AuthzDenied     uint64 `json:"authorization-denied"`
+	AuthzErrors     uint64 `json:"authorization-errors"`
+	AcctStarted     uint64 `json:"accounting-started"`
+	AcctStartErrors uint64 `json:"accounting-start-errors"`
+	AcctStopped     uint64 `json:"accounting-stopped"`
+	AcctStopErrors  uint64 `json:"accounting-stop-errors"`
+}
+
+func (p *AAAProtocol) countAuthz(authorized bool, err error) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	switch {
+	case err != nil:
+		p.stats.AuthzErrors++
+	case authorized:
+		p.stats.AuthzAllowed++
+	default:
+		p.stats.AuthzDenied++
+	}
+}
+
+func (p *AAAProtocol) countAcct(op string, err error) {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	switch {
+	case op == OpAccountStart && err != nil:
+		p.stats.AcctStartErrors++
+	case op == OpAccountStart:
+		p.stats.AcctStarted++
+	case err != nil:
+		p.stats.AcctStopErrors++
+	default:
+		p.stats.AcctStopped++
+	}
+}
+
+// Stats returns the protocol's counters
+func (p *AAAProtocol) Stats() ProtocolStats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	return p.stats
+}
+
+// Stats returns the counters of each loaded protocol, keyed by protocol name.
+// The counters of a protocol start from zero whenever it is (re)loaded.
+func (a *AAA) Stats() map[string]ProtocolStats {
+	stats := make(map[string]ProtocolStats)
+	for _, protocol := range a.OrderedProtocols() {
+		stats[protocol.Cfg.Name] = protocol.Stats()
+	}
+	return stats
+}
+
+// ResetStats resets the counters of all loaded protocols to zero
+func (a *AAA) ResetStats() {
+	for _, protocol := range a.OrderedProtocols() {
+		protocol.statsMu.Lock()
+		protocol.stats = ProtocolStats{}
+		protocol.statsMu.Unlock()
+	}
+}
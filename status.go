@@ -0,0 +1,139 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ProtocolInfo describes a loaded protocol, e.g. for operational status output
+type ProtocolInfo struct {
+	Name      string `json:"name"`
+	CmdAcct   bool   `json:"command-accounting"`
+	CmdAuthor bool   `json:"command-authorization"`
+	Enabled   bool   `json:"enabled"`
+	Healthy   bool   `json:"healthy"`
+	// Zero for disabled protocols, which are not loaded
+	APIVersion uint32 `json:"api-version"`
+	// See AAAProtocol.ConfigModTime and AAAProtocol.PluginModTime
+	ConfigModTime time.Time `json:"config-mod-time"`
+	PluginModTime time.Time `json:"plugin-mod-time"`
+	// Backend servers the protocol uses, see AAAPluginBackends
+	Backends []string `json:"backends,omitempty"`
+	// Whether the protocol's backend was reachable once it was set up, or
+	// nil if it was not pinged, see PingOnSetup
+	Reachable *bool `json:"reachable,omitempty"`
+}
+
+func (p *AAAProtocol) info() ProtocolInfo {
+	return ProtocolInfo{
+		Name:          p.Cfg.Name,
+		CmdAcct:       p.Cfg.CmdAcct,
+		CmdAuthor:     p.Cfg.CmdAuthor,
+		Enabled:       true,
+		Healthy:       p.healthy(),
+		APIVersion:    p.Version(),
+		ConfigModTime: p.ConfigModTime,
+		PluginModTime: p.PluginModTime,
+		Backends:      p.backends(),
+		Reachable:     p.reachable(),
+	}
+}
+
+// Version returns the plugin API version negotiated with the protocol's
+// plugin. Protocols not loaded from a plugin file, and so with no APIVersion
+// recorded, implement the current AAAPluginAPIVersion.
+func (p *AAAProtocol) Version() uint32 {
+	if p.APIVersion == 0 {
+		return AAAPluginAPIVersion
+	}
+	return p.APIVersion
+}
+
+// ProtocolInfo describes each loaded protocol, in the order given by
+// OrderedProtocols, followed by each protocol whose config disables it, in
+// order of name.
+func (a *AAA) ProtocolInfo() []ProtocolInfo {
+	protocols := a.OrderedProtocols()
+	info := make([]ProtocolInfo, 0, len(protocols))
+	for _, protocol := range protocols {
+		info = append(info, protocol.info())
+	}
+
+	a.mu.RLock()
+	disabled := make([]ProtocolInfo, 0, len(a.disabled))
+	for _, cfg := range a.disabled {
+		disabled = append(disabled, ProtocolInfo{
+			Name:      cfg.Name,
+			CmdAcct:   cfg.CmdAcct,
+			CmdAuthor: cfg.CmdAuthor,
+		})
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(disabled, func(i, j int) bool {
+		return disabled[i].Name < disabled[j].Name
+	})
+	return append(info, disabled...)
+}
+
+// EffectiveConfig describes the config of a protocol as computed by the
+// loader, see DumpConfig
+type EffectiveConfig struct {
+	// With defaults applied and secrets redacted, see
+	// AAAPluginConfig.Redacted. Empty contexts apply to all contexts.
+	Config AAAPluginConfig `json:"config"`
+	// "loaded", or "disabled" for protocols whose config disables them
+	Status string `json:"status"`
+	// Zero for disabled protocols, which are not loaded
+	APIVersion uint32 `json:"api-version"`
+}
+
+// Returns cfg with defaults applied, redacted
+func effectiveConfig(cfg AAAPluginConfig) AAAPluginConfig {
+	cfg = cfg.Redacted()
+	enabled := cfg.IsEnabled()
+	cfg.Enabled = &enabled
+	contexts := make([]string, 0, len(cfg.Contexts))
+	for _, context := range cfg.Contexts {
+		contexts = append(contexts, normalizeContext(context))
+	}
+	cfg.Contexts = contexts
+	return cfg
+}
+
+// DumpConfig returns the effective config of each loaded protocol, in the order
+// given by OrderedProtocols, followed by that of each protocol whose config
+// disables it, in order of name, as indented JSON. This shows the configs
+// after validation and with defaults applied, e.g. for support bundles.
+func (a *AAA) DumpConfig() ([]byte, error) {
+	protocols := a.OrderedProtocols()
+	configs := make([]EffectiveConfig, 0, len(protocols))
+	for _, protocol := range protocols {
+		configs = append(configs, EffectiveConfig{
+			Config:     effectiveConfig(protocol.Cfg),
+			Status:     "loaded",
+			APIVersion: protocol.Version(),
+		})
+	}
+
+	a.mu.RLock()
+	disabled := make([]EffectiveConfig, 0, len(a.disabled))
+	for _, cfg := range a.disabled {
+		disabled = append(disabled, EffectiveConfig{
+			Config: effectiveConfig(cfg),
+			Status: "disabled",
+		})
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(disabled, func(i, j int) bool {
+		return disabled[i].Config.Name < disabled[j].Config.Name
+	})
+	return json.MarshalIndent(append(configs, disabled...), "", "  ")
+}
@@ -0,0 +1,494 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"errors"
+	"fmt"
+	"github.com/danos/utils/pathutil"
+	"time"
+)
+
+// Default delay before retrying a failed accounting operation
+const DefaultAcctRetryDelayMs = 100
+
+// RetryableError may be implemented by errors returned from AAATask methods to
+// indicate that the operation failed transiently, e.g. due to a network
+// error, and may succeed if retried.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+func isRetryable(err error) bool {
+	var r RetryableError
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// Returned when no protocol is valid for a user
+var ErrNoProtocol = errors.New("No AAA protocol is valid for the user")
+
+// Returned by RunAccounted when the path is not authorized
+var ErrNotAuthorized = errors.New("Not authorized")
+
+// Operations reported to a MetricsSink
+const (
+	OpAccountStart = "AccountStart"
+	OpAccountStop  = "AccountStop"
+)
+
+// MetricsSink receives timing measurements of AAA operations
+type MetricsSink interface {
+	ObserveDuration(op string, d time.Duration)
+}
+
+// SetMetricsSink sets the sink to which tasks created by NewTimedTask report
+// their timings, and which is told the number of queued plugin calls if it
+// implements QueueMetricsSink. A nil sink disables reporting.
+func (a *AAA) SetMetricsSink(sink MetricsSink) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.metrics = sink
+	setQueueMetricsSink(a, sink)
+}
+
+func (a *AAA) metricsSink() MetricsSink {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.metrics
+}
+
+// Returns the first protocol with command accounting enabled, in the order
+// given by OrderedProtocols, which applies to the context and is valid for the
+// given user.
+func (a *AAA) accountingProtocol(context string, uid uint32,
+	groups []string) (*AAAProtocol, error) {
+	return a.firstAccountingProtocol(uid, groups, func(cfg AAAPluginConfig) bool {
+		return cfg.appliesTo(context)
+	})
+}
+
+// PluginForUser returns the protocol which accounts the tasks of the given
+// user: the protocol with command accounting enabled and the highest priority,
+// i.e. the lowest Priority, whose ValidUser returns true. Ties in priority are
+// broken by name, as for OrderedProtocols, so the choice is deterministic.
+//
+// Contexts are not taken into account. NewTimedTask and the other task
+// helpers make the same choice among the protocols which apply to the
+// request's context (see AAAPluginConfig.Contexts).
+//
+// ErrNoProtocol is returned if no protocol is valid for the user. If checking
+// whether a protocol is valid fails it is skipped, and the last such error is
+// returned if no later protocol is valid.
+func (a *AAA) PluginForUser(uid uint32, groups []string) (*AAAProtocol, error) {
+	return a.firstAccountingProtocol(uid, groups, func(AAAPluginConfig) bool {
+		return true
+	})
+}
+
+func (a *AAA) firstAccountingProtocol(uid uint32, groups []string,
+	applies func(AAAPluginConfig) bool) (*AAAProtocol, error) {
+	var lastErr error
+	for _, protocol := range a.OrderedProtocols() {
+		if !protocol.Cfg.CmdAcct || !applies(protocol.Cfg) {
+			continue
+		}
+		valid, err := protocol.ValidUser(uid, groups)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if valid {
+			return protocol, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrNoProtocol
+}
+
+// Reports whether any loaded protocol with command accounting enabled applies
+// to the normalized context
+func (a *AAA) hasAcctProtocol(context string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, protocol := range a.Protocols {
+		if protocol.Cfg.CmdAcct && protocol.Cfg.appliesTo(context) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTimedTask instantiates a task, using the first protocol with command
+// accounting enabled which applies to the context and is valid for the user,
+// whose AccountStart and AccountStop durations are reported to the
+// sink set with SetMetricsSink. See AAAPlugin.NewTask for a description of
+// the parameters. The task is given a unique identifier, see TaskID.
+//
+// If no loaded protocol with command accounting enabled applies to the
+// context, a task which accounts nothing is returned. Otherwise ErrNoProtocol
+// is returned if none of them is valid for the user.
+func (a *AAA) NewTimedTask(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	context = normalizeContext(context)
+	if !a.hasAcctProtocol(context) {
+		return nullTask{}, nil
+	}
+	protocol, err := a.accountingProtocol(context, uid, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.tasks.start(); err != nil {
+		return nil, err
+	}
+	env, id := withTaskIDEnv(env)
+	task, err := protocol.newTask(context, uid, groups, path, pathAttrs, env)
+	if err != nil {
+		a.tasks.done()
+		return nil, err
+	}
+	task = protocol.recordTask(task,
+		a.newAccountRecord(id, context, uid, groups, path, pathAttrs, env))
+	return a.tasks.track(&timedTask{task: task, sink: a.metricsSink()}, id), nil
+}
+
+type timedTask struct {
+	task AAATask
+	sink MetricsSink
+}
+
+func (t *timedTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t *timedTask) observe(op string, start time.Time) {
+	if t.sink != nil {
+		t.sink.ObserveDuration(op, timeSince(start))
+	}
+}
+
+func (t *timedTask) AccountStart() error {
+	defer t.observe(OpAccountStart, timeNow())
+	return t.task.AccountStart()
+}
+
+func (t *timedTask) AccountStop(err *error) error {
+	defer t.observe(OpAccountStop, timeNow())
+	return t.task.AccountStop(err)
+}
+
+func (t *timedTask) AccountStopResult(result TaskResult) error {
+	defer t.observe(OpAccountStop, timeNow())
+	return AccountStopWithResult(t.task, result)
+}
+
+// RunAccounted authorizes path as Authorize would, then runs fn as a task
+// accounted by the first protocol with command accounting enabled which
+// applies to the context and is valid for the user. See AAAPlugin.NewTask for
+// a description of the other parameters.
+//
+// If path is not authorized fn is not run, and ErrNotAuthorized is returned,
+// or the error failing the authorization.
+//
+// The task's accounting is started before fn is run, and stopped with the
+// error returned by fn once it completes. Accounting is also stopped if fn
+// panics, before the panic is propagated. If no protocol with command
+// accounting enabled applies to the context, or none is valid for the user,
+// fn is run without accounting.
+//
+// If the task can not be created or its accounting started, fn is not run and
+// the error is returned. Otherwise the error returned by fn is returned, or
+// failing that any error stopping the task's accounting.
+func (a *AAA) RunAccounted(context string, uid uint32, groups []string, path []string,
+	attrs *pathutil.PathAttrs, env map[string]string, fn func() error) error {
+	authorized, err := a.Authorize(context, uid, groups, path, attrs)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return ErrNotAuthorized
+	}
+
+	context = normalizeContext(context)
+	if !a.hasAcctProtocol(context) {
+		return fn()
+	}
+	protocol, err := a.accountingProtocol(context, uid, groups)
+	if err == ErrNoProtocol {
+		return fn()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := a.tasks.start(); err != nil {
+		return err
+	}
+	defer a.tasks.done()
+
+	env, id := withTaskIDEnv(env)
+	task, err := protocol.newTask(context, uid, groups, path, attrs, env)
+	if err != nil {
+		return err
+	}
+	task = protocol.recordTask(task,
+		a.newAccountRecord(id, context, uid, groups, path, attrs, env))
+	if err := task.AccountStart(); err != nil {
+		return err
+	}
+
+	stopped := false
+	defer func() {
+		if stopped {
+			return
+		}
+		r := recover()
+		err := fmt.Errorf("Panic: %v", r)
+		task.AccountStop(&err)
+		panic(r)
+	}()
+
+	fnErr := fn()
+	stopped = true
+
+	if fnErr != nil {
+		task.AccountStop(&fnErr)
+		return fnErr
+	}
+	return task.AccountStop(nil)
+}
+
+// NewRetryingTask instantiates a task like NewTimedTask, whose AccountStart
+// and AccountStop operations are retried with exponential backoff if they
+// fail with a RetryableError. The number of retries and initial delay are
+// taken from the config of the protocol used. Other errors are returned
+// immediately.
+func (a *AAA) NewRetryingTask(context string, uid uint32, groups []string, path []string,
+	pathAttrs *pathutil.PathAttrs, env map[string]string) (AAATask, error) {
+	context = normalizeContext(context)
+	if !a.hasAcctProtocol(context) {
+		return nullTask{}, nil
+	}
+	protocol, err := a.accountingProtocol(context, uid, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.tasks.start(); err != nil {
+		return nil, err
+	}
+	env, id := withTaskIDEnv(env)
+	task, err := protocol.newTask(context, uid, groups, path, pathAttrs, env)
+	if err != nil {
+		a.tasks.done()
+		return nil, err
+	}
+	task = protocol.recordTask(task,
+		a.newAccountRecord(id, context, uid, groups, path, pathAttrs, env))
+
+	return a.tasks.track(&retryingTask{
+		task:    task,
+		retries: protocol.Cfg.AcctRetries,
+		delay:   protocol.acctRetryDelay(),
+	}, id), nil
+}
+
+// Delay before the first retry of a failed accounting operation
+func (p *AAAProtocol) acctRetryDelay() time.Duration {
+	delay := p.Cfg.AcctRetryDelayMs
+	if delay <= 0 {
+		delay = DefaultAcctRetryDelayMs
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// Runs op, retrying it up to retries times with exponential backoff from delay
+// while it fails with a RetryableError
+func retryAcct(retries int, delay time.Duration, op func() error) error {
+	err := op()
+	for i := 0; i < retries && err != nil && isRetryable(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = op()
+	}
+	return err
+}
+
+type retryingTask struct {
+	task    AAATask
+	retries int
+	delay   time.Duration
+}
+
+func (t *retryingTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t *retryingTask) retry(op func() error) error {
+	return retryAcct(t.retries, t.delay, op)
+}
+
+func (t *retryingTask) AccountStart() error {
+	return t.retry(t.task.AccountStart)
+}
+
+func (t *retryingTask) AccountStop(err *error) error {
+	return t.retry(func() error {
+		return t.task.AccountStop(err)
+	})
+}
+
+func (t *retryingTask) AccountStopResult(result TaskResult) error {
+	return t.retry(func() error {
+		return AccountStopWithResult(t.task, result)
+	})
+}
+
+// AAATaskUpdater may optionally be implemented by an AAATask to support
+// interim accounting records for long running tasks, e.g. TACACS+ watchdog
+// records.
+type AAATaskUpdater interface {
+	// Account that the task is still running
+	AccountUpdate() error
+}
+
+// TaskResult describes the outcome of a task, for accounting records
+type TaskResult struct {
+	// Exit code of the task, e.g. of a command
+	ExitCode int
+	// Error the task failed with, if any
+	Err error
+	// Further protocol specific attributes, e.g. bytes transferred
+	Attrs map[string]string
+}
+
+// AAATaskResult may optionally be implemented by an AAATask to account richer
+// results than AccountStop allows.
+type AAATaskResult interface {
+	// Account the end of the task, with the given result. Replaces
+	// AccountStop when used.
+	AccountStopResult(result TaskResult) error
+}
+
+// AccountStopWithResult stops the task's accounting with the given result.
+// If task does not implement AAATaskResult its AccountStop method is called
+// with result.Err instead, and the rest of the result is discarded.
+func AccountStopWithResult(task AAATask, result TaskResult) error {
+	if r, ok := task.(AAATaskResult); ok {
+		return r.AccountStopResult(result)
+	}
+	if result.Err == nil {
+		return task.AccountStop(nil)
+	}
+	err := result.Err
+	return task.AccountStop(&err)
+}
+
+// Implemented by the package's task wrappers to give access to the wrapped
+// task, for detection of the optional task interfaces.
+type aaaTaskWrapper interface {
+	wrapped() AAATask
+}
+
+func unwrapAAATask(task AAATask) AAATask {
+	for {
+		w, ok := task.(aaaTaskWrapper)
+		if !ok {
+			return task
+		}
+		task = w.wrapped()
+	}
+}
+
+// Returns the function through which calls into the plugin's task wrapped by
+// task are made: that of its guardedTask, so that they are subject to the same
+// timeout as its other accounting calls, or callPlugin
+func pluginTaskCall(task AAATask) func(func() error) error {
+	for {
+		if g, ok := task.(guardedTask); ok {
+			return g.call
+		}
+		w, ok := task.(aaaTaskWrapper)
+		if !ok {
+			return callPlugin
+		}
+		task = w.wrapped()
+	}
+}
+
+// NewUpdatingTask wraps task so that, once its accounting is started,
+// AccountUpdate is called every interval until its accounting is stopped.
+//
+// If task does not implement AAATaskUpdater, or interval is not positive, no
+// updates are made. Errors from AccountUpdate are ignored; the next update is
+// still attempted.
+func NewUpdatingTask(task AAATask, interval time.Duration) AAATask {
+	return &updatingTask{task: task, interval: interval}
+}
+
+type updatingTask struct {
+	task     AAATask
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func (t *updatingTask) wrapped() AAATask {
+	return t.task
+}
+
+func (t *updatingTask) AccountStart() error {
+	if err := t.task.AccountStart(); err != nil {
+		return err
+	}
+
+	u, ok := unwrapAAATask(t.task).(AAATaskUpdater)
+	if !ok || t.interval <= 0 || t.stop != nil {
+		return nil
+	}
+
+	call := pluginTaskCall(t.task)
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				call(u.AccountUpdate)
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *updatingTask) stopUpdates() {
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+}
+
+func (t *updatingTask) AccountStop(err *error) error {
+	t.stopUpdates()
+	return t.task.AccountStop(err)
+}
+
+func (t *updatingTask) AccountStopResult(result TaskResult) error {
+	t.stopUpdates()
+	return AccountStopWithResult(t.task, result)
+}
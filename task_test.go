@@ -0,0 +1,207 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTasksSkipProtocolsWithoutCmdAcct(t *testing.T) {
+	acct, author, a := loadMixedAAA(t)
+
+	if protocol, err := a.PluginForUser(1000, nil); err != nil || protocol.Cfg.Name != "acct" {
+		t.Errorf("PluginForUser() = %v, %v, want acct", protocol, err)
+	}
+
+	newTasks := map[string]func() (AAATask, error){
+		"NewTimedTask": func() (AAATask, error) {
+			return a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+		},
+		"NewRetryingTask": func() (AAATask, error) {
+			return a.NewRetryingTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+		},
+	}
+	for name, newTask := range newTasks {
+		task, err := newTask()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		task.AccountStart()
+		task.AccountStop(nil)
+		if got := acct.lastTask(); got == nil || got.starts != 1 || got.stops != 1 {
+			t.Errorf("%s: task not accounted by acct: %+v", name, got)
+		}
+	}
+
+	if got := len(acct.tasks); got != 2 {
+		t.Errorf("acct accounted %d tasks, want 2", got)
+	}
+	if author.lastTask() != nil || author.validUserCalls() != 0 {
+		t.Error("Protocol without command accounting consulted for tasks")
+	}
+}
+
+func TestRunAccountedAuthorizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		deny    bool
+		panics  bool
+		wantRun bool
+	}{
+		{"authorized", false, false, true},
+		{"denied", true, false, false},
+		{"authorization failed", false, true, false},
+	}
+
+	for _, test := range tests {
+		acct, author, a := loadMixedAAA(t)
+		author.deny = test.deny
+		if test.panics {
+			author.panics = map[string]bool{"Authorize": true}
+		}
+
+		ran := false
+		err := a.RunAccounted("conf-mode", 1000, nil, []string{"show"}, nil, nil,
+			func() error { ran = true; return nil })
+		if ran != test.wantRun || (err == nil) != test.wantRun {
+			t.Errorf("%s: RunAccounted() = %v, ran: %v, want ran: %v",
+				test.name, err, ran, test.wantRun)
+		}
+		if test.deny && err != ErrNotAuthorized {
+			t.Errorf("%s: RunAccounted() = %v, want ErrNotAuthorized", test.name, err)
+		}
+		if got, want := len(acct.tasks), map[bool]int{true: 1}[test.wantRun]; got != want {
+			t.Errorf("%s: acct accounted %d tasks, want %d", test.name, got, want)
+		}
+		if author.lastTask() != nil {
+			t.Errorf("%s: protocol without command accounting accounted the task", test.name)
+		}
+	}
+}
+
+func TestOldStyleTasksStopWithResult(t *testing.T) {
+	var seq int
+	defer SetTaskIDGenerator(func() string {
+		seq++
+		return fmt.Sprintf("task-%d", seq)
+	})()
+
+	plugin := &mockPlugin{}
+	a := newMockAAA(t, mockProtocol{"mock", AAAPluginConfig{CmdAcct: true}, plugin})
+
+	newTasks := []struct {
+		name    string
+		newTask func() (AAATask, error)
+	}{
+		{"NewTimedTask", func() (AAATask, error) {
+			return a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+		}},
+		{"NewRetryingTask", func() (AAATask, error) {
+			return a.NewRetryingTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+		}},
+		{"NewUpdatingTask", func() (AAATask, error) {
+			task, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return NewUpdatingTask(task, time.Hour), nil
+		}},
+	}
+	errFailed := errors.New("failed")
+	results := []TaskResult{
+		{ExitCode: 0},
+		{ExitCode: 1, Err: errFailed, Attrs: map[string]string{"bytes": "10"}},
+	}
+
+	for _, test := range newTasks {
+		for _, result := range results {
+			task, err := test.newTask()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			if err := task.AccountStart(); err != nil {
+				t.Fatalf("%s: AccountStart() = %v", test.name, err)
+			}
+			if err := AccountStopWithResult(task, result); err != nil {
+				t.Errorf("%s: AccountStopWithResult() = %v", test.name, err)
+			}
+
+			got := plugin.lastTask()
+			if got.starts != 1 || got.stops != 1 || got.stopErr != result.Err {
+				t.Errorf("%s: task stopped %d times with %v, want once with %v",
+					test.name, got.stops, got.stopErr, result.Err)
+			}
+			want := fmt.Sprintf("task-%d", seq)
+			if id := TaskID(task); id != want || got.env[EnvTaskID] != want {
+				t.Errorf("%s: TaskID() = %q, plugin given %q, want %q",
+					test.name, id, got.env[EnvTaskID], want)
+			}
+		}
+	}
+}
+
+func TestTasksForContextWithoutAccounting(t *testing.T) {
+	plugin := &mockPlugin{invalid: true}
+	cfg := AAAPluginConfig{CmdAcct: true, Contexts: []string{"op-mode"}}
+	a := newMockAAA(t, mockProtocol{"mock", cfg, plugin})
+
+	task, err := a.NewTimedTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+	if task == nil || err != nil {
+		t.Errorf("NewTimedTask() = %v, %v, want a task accounting nothing", task, err)
+	}
+	task, err = a.NewRetryingTask("conf-mode", 1000, nil, []string{"show"}, nil, nil)
+	if task == nil || err != nil {
+		t.Errorf("NewRetryingTask() = %v, %v, want a task accounting nothing", task, err)
+	}
+	ran := false
+	a.SetAuthzPolicy(AuthzPolicy{Default: AllowWhenNoProtocols})
+	err = a.RunAccounted("conf-mode", 1000, nil, []string{"show"}, nil, nil,
+		func() error { ran = true; return nil })
+	if !ran || err != nil {
+		t.Errorf("RunAccounted() = %v, ran: %v, want fn run without accounting", err, ran)
+	}
+	if got := plugin.validUserCalls(); got != 0 {
+		t.Errorf("Protocol for another context consulted %d times", got)
+	}
+
+	_, err = a.NewTimedTask("op-mode", 1000, nil, []string{"show"}, nil, nil)
+	if err != ErrNoProtocol {
+		t.Errorf("NewTimedTask() in op-mode = %v, want ErrNoProtocol", err)
+	}
+}
+
+func TestNewTaskCtxBoundsAccounting(t *testing.T) {
+	plugin := &mockPlugin{block: make(chan struct{})}
+	defer close(plugin.block)
+	cfg := acctAuthorCfg
+	cfg.AcctTimeoutMs = 10
+	a := newMockAAA(t, mockProtocol{"mock", cfg, plugin})
+	protocol, _ := a.Protocol("mock")
+
+	task, err := protocol.NewTaskCtx(context.Background(), "conf-mode", 1000, nil,
+		[]string{"show"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating task: %v", err)
+	}
+	task = NewUpdatingTask(task, time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- task.AccountStart()
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("AccountStart() = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AccountStart() not abandoned after the accounting timeout")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+)
+
+// AAATaskID is implemented by tasks created by NewTimedTask and
+// NewRetryingTask, see TaskID.
+type AAATaskID interface {
+	// Returns the identifier passed to the plugin as EnvTaskID
+	TaskID() string
+}
+
+// TaskID returns the identifier of task, which is unique for each task created
+// by NewTimedTask, NewRetryingTask and RunAccounted and passed to the plugin
+// as EnvTaskID so that the start and stop records of a task can be matched.
+// Tasks wrapped by this package, e.g. by NewUpdatingTask, are unwrapped to find
+// it. Empty if task has no identifier.
+func TaskID(task AAATask) string {
+	for task != nil {
+		if t, ok := task.(AAATaskID); ok {
+			return t.TaskID()
+		}
+		w, ok := task.(aaaTaskWrapper)
+		if !ok {
+			break
+		}
+		task = w.wrapped()
+	}
+	return ""
+}
+
+var taskIDSeq uint64
+
+// Generates random (version 4) UUIDs, the default task identifiers
+func randomTaskID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Still unique within the process
+		return fmt.Sprintf("task-%d", atomic.AddUint64(&taskIDSeq, 1))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+type taskIDGenHolder struct{ gen func() string }
+
+var taskIDGen atomic.Value
+
+func init() {
+	taskIDGen.Store(taskIDGenHolder{randomTaskID})
+}
+
+// Generates a task identifier, see SetTaskIDGenerator
+func newTaskID() string {
+	return taskIDGen.Load().(taskIDGenHolder).gen()
+}
+
+// SetTaskIDGenerator makes tasks, and records passed to AccountAsync,
+// identified by the result of gen instead of a random UUID, e.g. so that they
+// carry the identifiers of the caller's request tracing. It returns a function
+// restoring the previous generator. gen must be safe to call concurrently and
+// return identifiers which are unique within the process; a nil gen selects
+// random UUIDs. See TaskID.
+func SetTaskIDGenerator(gen func() string) (restore func()) {
+	if gen == nil {
+		gen = randomTaskID
+	}
+	prev := taskIDGen.Load().(taskIDGenHolder)
+	taskIDGen.Store(taskIDGenHolder{gen})
+	return func() { taskIDGen.Store(prev) }
+}
+
+// Returns env with EnvTaskID set to a new identifier, unless the caller
+// already set it, along with the identifier. env is not modified.
+func withTaskIDEnv(env map[string]string) (map[string]string, string) {
+	if id := env[EnvTaskID]; id != "" {
+		return env, id
+	}
+
+	id := newTaskID()
+	withID := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		withID[k] = v
+	}
+	withID[EnvTaskID] = id
+	return withID, id
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build aaatest
+// +build aaatest
+
+// Test-only helpers, only built with the aaatest build tag.
+
+package aaa
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type testPlugin struct {
+	cfg    AAAPluginConfig
+	plugin AAAPlugin
+}
+
+var testRegistry = struct {
+	sync.Mutex
+	plugins map[string]testPlugin
+}{plugins: make(map[string]testPlugin)}
+
+// RegisterTestPlugin adds plugin to the registry used by LoadAAATest, under
+// the given name, replacing any plugin previously registered with the name.
+// As for AddProtocol, a zero Priority in cfg is taken to be DefaultPriority.
+func RegisterTestPlugin(name string, cfg AAAPluginConfig, plugin AAAPlugin) {
+	testRegistry.Lock()
+	defer testRegistry.Unlock()
+
+	cfg.Name = name
+	if cfg.Priority == 0 {
+		cfg.Priority = DefaultPriority
+	}
+	testRegistry.plugins[name] = testPlugin{cfg: cfg, plugin: plugin}
+}
+
+// ResetTestPlugins empties the registry used by LoadAAATest.
+func ResetTestPlugins() {
+	testRegistry.Lock()
+	defer testRegistry.Unlock()
+
+	testRegistry.plugins = make(map[string]testPlugin)
+}
+
+// LoadAAATest builds an AAA from the plugins registered with
+// RegisterTestPlugin, validating their configs and setting them up as
+// LoadAAA would, in order of name, but without opening any plugin files.
+// Plugins which fail to set up are logged and skipped, or if StrictLoad is set
+// abandon the load.
+func LoadAAATest() (*AAA, error) {
+	testRegistry.Lock()
+	defer testRegistry.Unlock()
+
+	aaa := NewAAA(nil)
+	logger := aaa.log()
+
+	names := make([]string, 0, len(testRegistry.plugins))
+	for name := range testRegistry.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs LoadErrors
+	for _, name := range names {
+		p := testRegistry.plugins[name]
+		protocol := &AAAProtocol{Cfg: p.cfg, Plugin: p.plugin}
+		err := p.cfg.Validate()
+		if skipDoingNothing(logger, name, err, StrictLoad) {
+			continue
+		}
+		if err == nil {
+			err = aaa.setupAAAProtocol(context.Background(), name, protocol)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			logger.Printf("%v", err)
+			errs = append(errs, err)
+			aaa.failed = append(aaa.failed, failedEvent(p.cfg, name, err))
+			if StrictLoad {
+				aaa.teardown()
+				return nil, errs
+			}
+			continue
+		}
+		aaa.addLoadedProtocol(name, protocol)
+	}
+
+	if len(errs) > 0 {
+		return aaa, errs
+	}
+	return aaa, nil
+}
+
+// TestClock is a manually advanced clock for use with SetClock. The zero
+// value starts at the zero time.
+type TestClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewTestClock returns a TestClock starting at t.
+func NewTestClock(t time.Time) *TestClock {
+	return &TestClock{now: t}
+}
+
+// Now returns the clock's current time.
+func (c *TestClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *TestClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// SetClock makes cache expiry, Watch debouncing and metrics durations read
+// the time from c, e.g. a TestClock, instead of real time, and returns a
+// function restoring the previous clock. Timers and timeouts are unaffected.
+func SetClock(c interface{ Now() time.Time }) (restore func()) {
+	prev := setClock(c)
+	return func() { setClock(prev) }
+}
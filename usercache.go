@@ -0,0 +1,105 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time for which a negative ValidUser result is cached, if caching is enabled
+// for a protocol but its config does not specify a negative cache time.
+// Applies only when shorter than the positive cache time.
+const DefaultValidUserNegativeCacheSeconds = 5
+
+type validUserCacheEntry struct {
+	uid     uint32
+	valid   bool
+	expires time.Time
+}
+
+func validUserCacheKey(uid uint32, groups []string) string {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return strconv.FormatUint(uint64(uid), 10) + "\x00" + strings.Join(sorted, "\x00")
+}
+
+func (p *AAAProtocol) validUserCacheTTL(valid bool) time.Duration {
+	ttl := p.Cfg.ValidUserCacheSeconds
+	if !valid {
+		neg := p.Cfg.ValidUserNegativeCacheSeconds
+		if neg == 0 {
+			neg = DefaultValidUserNegativeCacheSeconds
+		}
+		if neg < ttl {
+			ttl = neg
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// ValidUser checks whether the user is valid for the protocol's plugin.
+//
+// If the protocol's config enables it, results are cached for the
+// configured time. Errors are never cached.
+func (p *AAAProtocol) ValidUser(uid uint32, groups []string) (bool, error) {
+	if p.Cfg.ValidUserCacheSeconds <= 0 {
+		return p.validUser(uid, groups)
+	}
+
+	key := validUserCacheKey(uid, groups)
+	now := timeNow()
+
+	p.userCacheMu.Lock()
+	entry, ok := p.userCache[key]
+	if ok && now.After(entry.expires) {
+		delete(p.userCache, key)
+		ok = false
+	}
+	p.userCacheMu.Unlock()
+	if ok {
+		return entry.valid, nil
+	}
+
+	valid, err := p.validUser(uid, groups)
+	if err != nil {
+		return false, err
+	}
+
+	p.userCacheMu.Lock()
+	if p.userCache == nil {
+		p.userCache = make(map[string]validUserCacheEntry)
+	}
+	p.userCache[key] = validUserCacheEntry{
+		uid:     uid,
+		valid:   valid,
+		expires: now.Add(p.validUserCacheTTL(valid)),
+	}
+	p.userCacheMu.Unlock()
+
+	return valid, nil
+}
+
+func (p *AAAProtocol) invalidateUserCache(uid uint32) {
+	p.userCacheMu.Lock()
+	defer p.userCacheMu.Unlock()
+
+	for key, entry := range p.userCache {
+		if entry.uid == uid {
+			delete(p.userCache, key)
+		}
+	}
+}
+
+// InvalidateUserCache flushes any cached ValidUser results for the given
+// user from all protocols, e.g. on logout.
+func (a *AAA) InvalidateUserCache(uid uint32) {
+	for _, protocol := range a.OrderedProtocols() {
+		protocol.invalidateUserCache(uid)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Interval at which Watch polls the plugin config directory for changes
+var WatchPollInterval = 250 * time.Millisecond
+
+// Changes seen by Watch within this period of each other result in a single
+// reload, once no further changes have been seen for the period.
+var WatchDebounce = 500 * time.Millisecond
+
+type cfgFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Returns the state of each plugin config file in cfgFS, and of the defaults
+// file, if any
+func snapshotAAAPluginsCfgDir(cfgFS fs.FS) (map[string]cfgFileState, error) {
+	files, err := readAAAPluginsCfgDir(cfgFS)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]cfgFileState, len(files))
+	for _, file := range files {
+		fi, err := fs.Stat(cfgFS, file)
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		state[file] = cfgFileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	if fi, err := fs.Stat(cfgFS, AAAPluginsDefaultsCfgFile); err == nil {
+		state[AAAPluginsDefaultsCfgFile] = cfgFileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return state, nil
+}
+
+// As snapshotAAAPluginsCfgDir, additionally including the plugin files of the
+// protocols loaded from config files, keyed by path, so that a replaced plugin
+// binary is reloaded.
+func (a *AAA) snapshotWatched(cfgFS fs.FS, pluginDir string) (map[string]cfgFileState, error) {
+	state, err := snapshotAAAPluginsCfgDir(cfgFS)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, protocol := range a.OrderedProtocols() {
+		if protocol.cfgFile == "" {
+			continue
+		}
+		path, err := pluginPath(pluginDir, protocol.Cfg.pluginFile())
+		if err != nil {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			state[path] = cfgFileState{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return state, nil
+}
+
+func cfgDirChanged(old, new map[string]cfgFileState) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for file, state := range new {
+		o, ok := old[file]
+		if !ok || o.size != state.size || !o.modTime.Equal(state.modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch monitors the plugin config directory and calls Reload whenever plugin
+// configs are created, modified or deleted, or the plugin file of a loaded
+// protocol is replaced, until ctx is cancelled.
+//
+// Watching is poll-only: the directory is polled every WatchPollInterval, and
+// a burst of changes is coalesced into one reload as described for
+// WatchDebounce, so a change is picked up within roughly the sum of the two.
+// Filesystem notifications such as inotify are not used, as they would add a
+// platform-specific dependency, are not available for every config directory
+// (see LoadAAAFS), and miss changes made through symlinked configs or
+// replaced mounts, which polling the resolved files observes. Each poll stats
+// the config files and the plugin files of the loaded protocols; increase
+// WatchPollInterval to reduce that cost. Reload failures are logged.
+func (a *AAA) Watch(ctx context.Context) error {
+	cfgFS, pluginDir := a.dirs()
+
+	last, err := a.snapshotWatched(cfgFS, pluginDir)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(WatchPollInterval)
+	defer ticker.Stop()
+
+	var pending bool
+	var changed time.Time
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		state, err := a.snapshotWatched(cfgFS, pluginDir)
+		if err != nil {
+			if err.Error() != lastErr {
+				a.log().Printf("Failed to watch AAA plugin config directory: %v", err)
+				lastErr = err.Error()
+			}
+			continue
+		}
+		lastErr = ""
+
+		now := timeNow()
+		if cfgDirChanged(last, state) {
+			last = state
+			pending = true
+			changed = now
+			continue
+		}
+
+		if pending && now.Sub(changed) >= WatchDebounce {
+			pending = false
+			err := a.Reload()
+			if _, ok := err.(LoadErrors); err != nil && !ok {
+				a.log().Printf("Failed to reload AAA plugins: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021, AT&T Intellectual Property Inc.
+// All rights reserved.
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package aaa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions of plugin config files, in order of precedence between files
+// with the same base name. JSON is the canonical format, but configs may
+// also be written in YAML, with the same keys. Both formats may be used in
+// the same directory.
+var cfgFileExts = []string{".json", ".yaml", ".yml"}
+
+func isCfgFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range cfgFileExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func isYAMLCfgFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Returns an error if a config file with the same base name as fn, and an
+// extension of higher precedence, exists
+func checkCfgFileConflict(cfgFS fs.FS, fn string) error {
+	ext := filepath.Ext(fn)
+	base := strings.TrimSuffix(fn, ext)
+	for _, e := range cfgFileExts {
+		if e == ext {
+			break
+		}
+		if _, err := fs.Stat(cfgFS, base+e); err == nil {
+			return fmt.Errorf("Plugin config file conflicts with %s", base+e)
+		}
+	}
+	return nil
+}
+
+// Decodes a YAML plugin config by converting it to JSON, so that it is
+// subject to exactly the same schema as JSON configs
+func decodeYAMLAAAPluginConfig(r io.Reader, defaults AAAPluginConfig) (AAAPluginConfig, error) {
+	in, e := io.ReadAll(r)
+	if e != nil {
+		err := fmt.Errorf("Failed to read plugin config file: %w", e)
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+
+	var doc interface{}
+	if e := yaml.Unmarshal(in, &doc); e != nil {
+		err := fmt.Errorf("Failed to decode plugin config file: %s", e)
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+
+	b, e := json.Marshal(doc)
+	if e != nil {
+		err := fmt.Errorf("Failed to decode plugin config file: %s", e)
+		return AAAPluginConfig{Priority: DefaultPriority}, err
+	}
+	return decodeAAAPluginConfig(bytes.NewReader(b), defaults)
+}